@@ -0,0 +1,37 @@
+package activego
+
+// CommandIDKey is the key in action data clients use to opt into
+// acknowledgements: once the action has been handled, an AckMessage or an
+// ErrorMessage carrying the same command ID is transmitted to the subscription.
+const CommandIDKey = "command_id"
+
+// CommandError is an error with a code and message meant for the client.
+// Other errors returned by handlers are reported to clients as internal errors.
+type CommandError struct {
+	Code    string
+	Message string
+}
+
+func NewCommandError(code, message string) *CommandError {
+	return &CommandError{Code: code, Message: message}
+}
+
+func (e *CommandError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func (c *StatelessConnection) acknowledge(identifier string, commandID interface{}, err error) error {
+	if err == nil {
+		return c.socket.Transmit(MessageResponseTransmission{
+			Message: AckMessage{
+				Type:      "ack",
+				CommandID: commandID,
+			},
+			Identifier: identifier,
+		})
+	}
+	return c.socket.Transmit(MessageResponseTransmission{
+		Message:    newErrorMessage(commandID, err),
+		Identifier: identifier,
+	})
+}
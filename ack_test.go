@@ -0,0 +1,68 @@
+package activego_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func ackServer() *activego.ServerBuilder {
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error {
+			return nil
+		}).
+		Received("forbidden", func(activego.Connection, activego.Channel, activego.ActionData) error {
+			return fmt.Errorf("wrapped: %w", activego.NewCommandError("forbidden", "Not allowed"))
+		}).
+		Received("crash", func(activego.Connection, activego.Channel, activego.ActionData) error {
+			return fmt.Errorf("database is down")
+		})
+	return server
+}
+
+func performWithCommandID(action string) *anycable.CommandMessage {
+	m := performMessage(action)
+	m.Data = `{"action":"` + action + `","command_id":42}`
+	return m
+}
+
+func TestAck_Success(t *testing.T) {
+	require := require.New(t)
+
+	r, err := ackServer().Command(context.Background(), performWithCommandID("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{`{"message":{"type":"ack","command_id":42},"identifier":"{\"channel\":\"ChatChannel\"}"}`}, r.Transmissions)
+}
+
+func TestAck_CommandError(t *testing.T) {
+	require := require.New(t)
+
+	r, err := ackServer().Command(context.Background(), performWithCommandID("forbidden"))
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"message":{"type":"error","command_id":42,"code":"forbidden","message":"Not allowed"},"identifier":"{\"channel\":\"ChatChannel\"}"}`}, r.Transmissions)
+}
+
+func TestAck_InternalError(t *testing.T) {
+	require := require.New(t)
+
+	r, err := ackServer().Command(context.Background(), performWithCommandID("crash"))
+	require.NoError(err)
+	require.Len(r.Transmissions, 1)
+	require.Contains(r.Transmissions[0], `"code":"internal_error"`)
+	require.NotContains(r.Transmissions[0], "database")
+}
+
+func TestAck_WithoutCommandID(t *testing.T) {
+	require := require.New(t)
+
+	r, err := ackServer().Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Empty(r.Transmissions)
+}
@@ -0,0 +1,78 @@
+package activego
+
+import "errors"
+
+var (
+	// ErrUnknownAction is returned for actions a channel has no handler for.
+	ErrUnknownAction = errors.New("unknown action")
+	// ErrMissingAction is returned for messages without an action under
+	// RejectMissingAction.
+	ErrMissingAction = errors.New("missing action")
+)
+
+// ReceiveAction is the action messages without an action key are handled
+// by, as in ActionCable.
+const ReceiveAction = "receive"
+
+// MissingActionPolicy decides what happens to messages without an action
+// key sent to channels with neither a Receive nor a ReceivedAny handler.
+type MissingActionPolicy int
+
+const (
+	// IgnoreMissingAction drops the message.
+	IgnoreMissingAction MissingActionPolicy = iota
+	// RejectMissingAction fails the command with ErrMissingAction.
+	RejectMissingAction
+)
+
+type AnyActionHandler func(c Connection, ch Channel, action string, data ActionData) error
+
+// Receiver is implemented by channel types handling messages without an
+// action key.
+type Receiver interface {
+	Receive(c Connection, data ActionData) error
+}
+
+// receive handles messages without an action key as ReceiveAction, falling
+// back to the ReceivedAny handler.
+func (c ChannelController) receive(data ActionData) error {
+	if _, ok := c.handlers.actionHandlers[ReceiveAction]; ok || c.handlers.perform != nil {
+		if err := c.HandleAction(ReceiveAction, data); err != nil {
+			return &ActionError{Action: ReceiveAction, CommandID: data[CommandIDKey], Err: err}
+		}
+		return nil
+	}
+	if c.server.missingAction == RejectMissingAction {
+		return ErrMissingAction
+	}
+	return nil
+}
+
+// dataReceiver is implemented by channels handling messages without an
+// action key.
+type dataReceiver interface {
+	receive(data ActionData) error
+}
+
+// ReceivedAny handles actions without a Received handler, which otherwise
+// fail with ErrUnknownAction. Messages without an action key go to it as
+// ReceiveAction unless the channel has a Receive handler.
+func (b *ChannelBuilder) ReceivedAny(handler AnyActionHandler) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.perform = handler })
+	return b
+}
+
+// Receive handles messages without an action key, like ActionCable's
+// receive(data). It's the handler of ReceiveAction, so clients can also
+// perform it explicitly.
+func (b *ChannelBuilder) Receive(handler ActionHandler) *ChannelBuilder {
+	return b.Received(ReceiveAction, handler)
+}
+
+// MissingAction sets the policy for messages without an action key sent to
+// channels with neither a Receive nor a ReceivedAny handler. They're ignored
+// by default.
+func (b *ServerBuilder) MissingAction(policy MissingActionPolicy) *ServerBuilder {
+	b.register(func() { b.handlers.missingAction = policy })
+	return b
+}
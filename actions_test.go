@@ -0,0 +1,123 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceivedAny(t *testing.T) {
+	require := require.New(t)
+
+	var performed []string
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			performed = append(performed, "speak")
+			return nil
+		}).
+		ReceivedAny(func(c activego.Connection, ch activego.Channel, action string, data activego.ActionData) error {
+			performed = append(performed, "any "+action)
+			return nil
+		})
+
+	for _, action := range []string{"speak", "shout"} {
+		r, err := server.Command(context.Background(), performMessage(action))
+		require.NoError(err)
+		require.Equal(anycable.Status_SUCCESS, r.Status)
+	}
+	require.Equal([]string{"speak", "any shout"}, performed)
+}
+
+func TestUnknownAction(t *testing.T) {
+	require := require.New(t)
+
+	var rescued error
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		RescueFrom(activego.ErrUnknownAction, func(c activego.Connection, ch activego.Channel, err error) error {
+			rescued = err
+			return nil
+		})
+
+	r, err := server.Command(context.Background(), performMessage("shout"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.True(errors.Is(rescued, activego.ErrUnknownAction))
+}
+
+func TestMissingAction(t *testing.T) {
+	require := require.New(t)
+
+	var received []activego.ActionData
+	var performed []string
+	var rescued error
+	server := activego.BuildServer(nil)
+	server.MissingAction(activego.RejectMissingAction)
+	server.DefaultErrorHandler(func(c activego.Connection, ch activego.Channel, err error) error {
+		rescued = err
+		return err
+	})
+	server.Channel("ChatChannel").
+		Receive(func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			received = append(received, data)
+			return nil
+		})
+	server.Channel("AnyChannel").
+		ReceivedAny(func(c activego.Connection, ch activego.Channel, action string, data activego.ActionData) error {
+			performed = append(performed, action)
+			return nil
+		})
+	server.Channel("OtherChannel")
+
+	send := func(channel string) anycable.Status {
+		r, err := server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "message",
+			Identifier:            `{"channel":"` + channel + `"}`,
+			ConnectionIdentifiers: `{}`,
+			Data:                  `{"text":"hello"}`,
+			Env:                   &anycable.Env{},
+		})
+		require.NoError(err)
+		return r.Status
+	}
+	require.Equal(anycable.Status_SUCCESS, send("ChatChannel"))
+	require.Equal([]activego.ActionData{{"text": "hello"}}, received)
+	require.Equal(anycable.Status_SUCCESS, send("AnyChannel"))
+	require.Equal([]string{activego.ReceiveAction}, performed)
+	require.Equal(anycable.Status_FAILURE, send("OtherChannel"))
+	require.Equal(activego.ErrMissingAction, rescued)
+}
+
+func TestServerBuilder_Registered(t *testing.T) {
+	require := require.New(t)
+
+	noop := func(activego.Connection, activego.Channel, activego.ActionData) error { return nil }
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Params(RoomParams{}).
+		Received("speak", noop).
+		Received("leave", noop).
+		AllowWhisper("room")
+	server.Channels("Admin::*").
+		ReceivedAny(func(activego.Connection, activego.Channel, string, activego.ActionData) error { return nil })
+	server.ChannelsMatching(regexp.MustCompile(`^Room\d+$`))
+	server.FallbackChannel()
+
+	require.Equal([]activego.ChannelInfo{
+		{
+			Name:    "RoomChannel",
+			Actions: []string{"leave", "speak"},
+			Params:  []activego.ParamInfo{{Name: "room", Required: true}, {Name: "limit"}},
+			Whisper: true,
+		},
+		{Name: "Admin::*", Pattern: true, Actions: []string{}, AnyAction: true},
+		{Name: `/^Room\d+$/`, Pattern: true, Actions: []string{}},
+		{Name: "", Fallback: true, Actions: []string{}},
+	}, server.Registered())
+}
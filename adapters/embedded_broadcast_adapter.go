@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/anycable/anycable-go/common"
+	"github.com/bilus/activego/anycable"
 )
 
 type Node interface {
@@ -12,6 +13,18 @@ type Node interface {
 	RemoteDisconnect(*common.RemoteDisconnectMessage)
 }
 
+// excludingNode is implemented by nodes able to skip a session when
+// broadcasting.
+type excludingNode interface {
+	BroadcastExcept(m *common.StreamMessage, sid string)
+}
+
+// offsetNode is implemented by nodes passing the offset of broadcasts in the
+// stream history on to clients.
+type offsetNode interface {
+	BroadcastOffset(m *common.StreamMessage, offset uint64, except string)
+}
+
 type embeddedBroadcastAdapter struct {
 	target Node
 }
@@ -34,6 +47,19 @@ func (a *embeddedBroadcastAdapter) BroadcastRaw(payload interface{}) error {
 		}
 	case common.StreamMessage:
 		a.target.Broadcast(&m)
+	case *anycable.Broadcast:
+		msg := &common.StreamMessage{Stream: m.Stream, Data: m.Data}
+		var except string
+		if m.Meta != nil {
+			except = m.Meta.ExcludeSocket
+		}
+		if node, ok := a.target.(offsetNode); ok && m.Offset != 0 {
+			node.BroadcastOffset(msg, m.Offset, except)
+		} else if node, ok := a.target.(excludingNode); ok && except != "" {
+			node.BroadcastExcept(msg, except)
+		} else {
+			a.target.Broadcast(msg)
+		}
 	default:
 		return fmt.Errorf("unrecognized payload type: %t", payload)
 	}
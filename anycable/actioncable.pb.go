@@ -0,0 +1,340 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        v3.13.0
+// source: actioncable.proto
+
+package anycable
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+type ProtobufType int32
+
+const (
+	ProtobufType_no_type              ProtobufType = 0
+	ProtobufType_welcome              ProtobufType = 1
+	ProtobufType_disconnect           ProtobufType = 2
+	ProtobufType_ping                 ProtobufType = 3
+	ProtobufType_confirm_subscription ProtobufType = 4
+	ProtobufType_reject_subscription  ProtobufType = 5
+)
+
+// Enum value maps for ProtobufType.
+var (
+	ProtobufType_name = map[int32]string{
+		0: "no_type",
+		1: "welcome",
+		2: "disconnect",
+		3: "ping",
+		4: "confirm_subscription",
+		5: "reject_subscription",
+	}
+	ProtobufType_value = map[string]int32{
+		"no_type":              0,
+		"welcome":              1,
+		"disconnect":           2,
+		"ping":                 3,
+		"confirm_subscription": 4,
+		"reject_subscription":  5,
+	}
+)
+
+func (x ProtobufType) Enum() *ProtobufType {
+	p := new(ProtobufType)
+	*p = x
+	return p
+}
+
+func (x ProtobufType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProtobufType) Descriptor() protoreflect.EnumDescriptor {
+	return file_actioncable_proto_enumTypes[0].Descriptor()
+}
+
+func (ProtobufType) Type() protoreflect.EnumType {
+	return &file_actioncable_proto_enumTypes[0]
+}
+
+func (x ProtobufType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProtobufType.Descriptor instead.
+func (ProtobufType) EnumDescriptor() ([]byte, []int) {
+	return file_actioncable_proto_rawDescGZIP(), []int{0}
+}
+
+type ProtobufCommand int32
+
+const (
+	ProtobufCommand_unknown_command ProtobufCommand = 0
+	ProtobufCommand_subscribe       ProtobufCommand = 1
+	ProtobufCommand_unsubscribe     ProtobufCommand = 2
+	ProtobufCommand_message         ProtobufCommand = 3
+)
+
+// Enum value maps for ProtobufCommand.
+var (
+	ProtobufCommand_name = map[int32]string{
+		0: "unknown_command",
+		1: "subscribe",
+		2: "unsubscribe",
+		3: "message",
+	}
+	ProtobufCommand_value = map[string]int32{
+		"unknown_command": 0,
+		"subscribe":       1,
+		"unsubscribe":     2,
+		"message":         3,
+	}
+)
+
+func (x ProtobufCommand) Enum() *ProtobufCommand {
+	p := new(ProtobufCommand)
+	*p = x
+	return p
+}
+
+func (x ProtobufCommand) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProtobufCommand) Descriptor() protoreflect.EnumDescriptor {
+	return file_actioncable_proto_enumTypes[1].Descriptor()
+}
+
+func (ProtobufCommand) Type() protoreflect.EnumType {
+	return &file_actioncable_proto_enumTypes[1]
+}
+
+func (x ProtobufCommand) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProtobufCommand.Descriptor instead.
+func (ProtobufCommand) EnumDescriptor() ([]byte, []int) {
+	return file_actioncable_proto_rawDescGZIP(), []int{1}
+}
+
+type ProtobufMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type       ProtobufType    `protobuf:"varint,1,opt,name=type,proto3,enum=anycable.ProtobufType" json:"type,omitempty"`
+	Command    ProtobufCommand `protobuf:"varint,2,opt,name=command,proto3,enum=anycable.ProtobufCommand" json:"command,omitempty"`
+	Identifier string          `protobuf:"bytes,3,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	// Action data sent by clients with the message command, JSON-encoded.
+	Data string `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// Payload of messages sent to clients, JSON-encoded.
+	Message   []byte `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Reason    string `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	Reconnect bool   `protobuf:"varint,7,opt,name=reconnect,proto3" json:"reconnect,omitempty"`
+}
+
+func (x *ProtobufMessage) Reset() {
+	*x = ProtobufMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_actioncable_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtobufMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtobufMessage) ProtoMessage() {}
+
+func (x *ProtobufMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_actioncable_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtobufMessage.ProtoReflect.Descriptor instead.
+func (*ProtobufMessage) Descriptor() ([]byte, []int) {
+	return file_actioncable_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ProtobufMessage) GetType() ProtobufType {
+	if x != nil {
+		return x.Type
+	}
+	return ProtobufType_no_type
+}
+
+func (x *ProtobufMessage) GetCommand() ProtobufCommand {
+	if x != nil {
+		return x.Command
+	}
+	return ProtobufCommand_unknown_command
+}
+
+func (x *ProtobufMessage) GetIdentifier() string {
+	if x != nil {
+		return x.Identifier
+	}
+	return ""
+}
+
+func (x *ProtobufMessage) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *ProtobufMessage) GetMessage() []byte {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *ProtobufMessage) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *ProtobufMessage) GetReconnect() bool {
+	if x != nil {
+		return x.Reconnect
+	}
+	return false
+}
+
+var File_actioncable_proto protoreflect.FileDescriptor
+
+var file_actioncable_proto_rawDesc = []byte{
+	0x0a, 0x11, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x08, 0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x22, 0xf6, 0x01,
+	0x0a, 0x0f, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x12, 0x2a, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x16, 0x2e, 0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x33, 0x0a,
+	0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19,
+	0x2e, 0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61,
+	0x6e, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69,
+	0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x72, 0x65, 0x63, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x72, 0x65, 0x63,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x2a, 0x75, 0x0a, 0x0c, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x6e, 0x6f, 0x5f, 0x74, 0x79, 0x70,
+	0x65, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x77, 0x65, 0x6c, 0x63, 0x6f, 0x6d, 0x65, 0x10, 0x01,
+	0x12, 0x0e, 0x0a, 0x0a, 0x64, 0x69, 0x73, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x10, 0x02,
+	0x12, 0x08, 0x0a, 0x04, 0x70, 0x69, 0x6e, 0x67, 0x10, 0x03, 0x12, 0x18, 0x0a, 0x14, 0x63, 0x6f,
+	0x6e, 0x66, 0x69, 0x72, 0x6d, 0x5f, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x10, 0x04, 0x12, 0x17, 0x0a, 0x13, 0x72, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x5f, 0x73,
+	0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x10, 0x05, 0x2a, 0x53, 0x0a,
+	0x0f, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x12, 0x13, 0x0a, 0x0f, 0x75, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x5f, 0x63, 0x6f, 0x6d, 0x6d,
+	0x61, 0x6e, 0x64, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69,
+	0x62, 0x65, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x75, 0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72,
+	0x69, 0x62, 0x65, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x10, 0x03, 0x42, 0x24, 0x5a, 0x22, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x62, 0x69, 0x6c, 0x75, 0x73, 0x2f, 0x61, 0x63, 0x74, 0x69, 0x76, 0x65, 0x67, 0x6f, 0x2f,
+	0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_actioncable_proto_rawDescOnce sync.Once
+	file_actioncable_proto_rawDescData = file_actioncable_proto_rawDesc
+)
+
+func file_actioncable_proto_rawDescGZIP() []byte {
+	file_actioncable_proto_rawDescOnce.Do(func() {
+		file_actioncable_proto_rawDescData = protoimpl.X.CompressGZIP(file_actioncable_proto_rawDescData)
+	})
+	return file_actioncable_proto_rawDescData
+}
+
+var file_actioncable_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_actioncable_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_actioncable_proto_goTypes = []interface{}{
+	(ProtobufType)(0),       // 0: anycable.ProtobufType
+	(ProtobufCommand)(0),    // 1: anycable.ProtobufCommand
+	(*ProtobufMessage)(nil), // 2: anycable.ProtobufMessage
+}
+var file_actioncable_proto_depIdxs = []int32{
+	0, // 0: anycable.ProtobufMessage.type:type_name -> anycable.ProtobufType
+	1, // 1: anycable.ProtobufMessage.command:type_name -> anycable.ProtobufCommand
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_actioncable_proto_init() }
+func file_actioncable_proto_init() {
+	if File_actioncable_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_actioncable_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtobufMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_actioncable_proto_rawDesc,
+			NumEnums:      2,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_actioncable_proto_goTypes,
+		DependencyIndexes: file_actioncable_proto_depIdxs,
+		EnumInfos:         file_actioncable_proto_enumTypes,
+		MessageInfos:      file_actioncable_proto_msgTypes,
+	}.Build()
+	File_actioncable_proto = out.File
+	file_actioncable_proto_rawDesc = nil
+	file_actioncable_proto_goTypes = nil
+	file_actioncable_proto_depIdxs = nil
+}
@@ -0,0 +1,19 @@
+package anycable
+
+// Broadcast is the JSON payload published to AnyCable servers, carrying
+// delivery options understood by AnyCable 1.4+ in Meta.
+type Broadcast struct {
+	Stream string         `json:"stream"`
+	Data   string         `json:"data"`
+	Meta   *BroadcastMeta `json:"meta,omitempty"`
+	// Offset is the position of the message in the stream history, if kept.
+	// The embedded node passes it on to clients (see StartEmbedded); other
+	// AnyCable servers ignore it.
+	Offset uint64 `json:"offset,omitempty"`
+}
+
+type BroadcastMeta struct {
+	// ExcludeSocket is the session ID of the client that shouldn't receive
+	// the message.
+	ExcludeSocket string `json:"exclude_socket,omitempty"`
+}
@@ -0,0 +1,19 @@
+// Package anycable contains the AnyCable RPC bindings and an embedded
+// anycable-go node serving them in-process.
+//
+// With stream history (see EmbeddedAnycable.SetHistory), clients of the
+// embedded node can resume streams after reconnecting by passing the last
+// offset they've seen per stream in the data of the subscribe command:
+//
+//	{"command":"subscribe","identifier":"{\"channel\":\"ChatChannel\"}","data":"{\"offsets\":{\"chat_1\":17}}"}
+//
+// Once the subscription is confirmed, the messages broadcast to its streams
+// after those offsets are transmitted, before any live ones. Messages
+// broadcast to streams with history carry their offset next to the
+// identifier:
+//
+//	{"identifier":"{\"channel\":\"ChatChannel\"}","message":"hi","stream":"chat_1","offset":18}
+package anycable
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. server.proto
+//go:generate protoc --go_out=paths=source_relative:. actioncable.proto
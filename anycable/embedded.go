@@ -9,6 +9,7 @@ import (
 	"github.com/anycable/anycable-go/common"
 	"github.com/anycable/anycable-go/metrics"
 	"github.com/anycable/anycable-go/node"
+	"github.com/bilus/activego/history"
 )
 
 type Server interface {
@@ -17,27 +18,107 @@ type Server interface {
 	Disconnect(c context.Context, r *DisconnectRequest) (*DisconnectResponse, error)
 }
 
+// BatchServer is implemented by servers able to handle several commands of
+// one connection in a single call. On error, CommandBatch returns the
+// responses of the commands handled before the failing one.
+type BatchServer interface {
+	CommandBatch(c context.Context, m []*CommandMessage) ([]*CommandResponse, error)
+}
+
 type EmbeddedAnycable struct {
-	appNode *node.Node
-	metrics *metrics.Metrics
+	appNode    *node.Node
+	metrics    *metrics.Metrics
+	controller *Controller
+	websockets *wsSessions
+	sessions   *HTTPSessions
 	http.Handler
+	// SSEHandler serves the same channels over Server-Sent Events.
+	SSEHandler http.Handler
+}
+
+// Sessions returns the sessions of HTTP-based transports, e.g. to serve them
+// with a long-polling handler.
+func (e EmbeddedAnycable) Sessions() *HTTPSessions {
+	return e.sessions
 }
 
 // TODO: Shutdown it in main.go
 func (e EmbeddedAnycable) Shutdown() {
+	e.sessions.Shutdown()
 	e.appNode.Shutdown()
 	e.metrics.Shutdown()
 }
 
 func (e EmbeddedAnycable) Broadcast(m *common.StreamMessage) {
 	e.appNode.Broadcast(m)
+	e.sessions.Broadcast(m)
+}
+
+// BroadcastExcept is Broadcast skipping the session with the ID, e.g. the
+// sender of a whisper. The node can't skip sessions, so the message is
+// delivered to every other session directly.
+func (e EmbeddedAnycable) BroadcastExcept(m *common.StreamMessage, sid string) {
+	for _, subscriber := range e.controller.streams.subscribers(m.Stream) {
+		if subscriber.sid != sid {
+			e.send(subscriber.sid, buildMessage(m.Data, subscriber.identifier))
+		}
+	}
+}
+
+// BroadcastOffset is BroadcastExcept for a message recorded in the stream
+// history with the offset, which clients get along with the message to
+// resume the stream. Subscriptions still being resumed get it replayed
+// instead.
+func (e EmbeddedAnycable) BroadcastOffset(m *common.StreamMessage, offset uint64, except string) {
+	for _, subscriber := range e.controller.streams.subscribersAt(m.Stream, offset) {
+		if subscriber.sid != except {
+			e.send(subscriber.sid, buildOffsetMessage(m.Data, subscriber.identifier, m.Stream, offset))
+		}
+	}
+}
+
+// SetHistory is Controller.SetHistory.
+func (e EmbeddedAnycable) SetHistory(h history.History) {
+	e.controller.SetHistory(h)
+}
+
+func (e EmbeddedAnycable) send(sid string, msg []byte) {
+	if session, ok := e.websockets.get(sid); ok {
+		session.Send(msg)
+	} else if session, ok := e.sessions.Get(sid); ok {
+		session.enqueue(msg)
+	}
 }
 
 func (e EmbeddedAnycable) RemoteDisconnect(m *common.RemoteDisconnectMessage) {
 	e.appNode.RemoteDisconnect(m)
+	e.sessions.RemoteDisconnect(m)
 }
 
-func StartEmbedded(server Server) EmbeddedAnycable {
+// EmbeddedConfig configures an embedded node. Zero fields are set to
+// defaults.
+type EmbeddedConfig struct {
+	// Subprotocols accepted by the WebSocket handler, actioncable-v1-json by
+	// default.
+	Subprotocols []string
+	// Headers passed on to connections, DefaultHeaders by default.
+	Headers []string
+}
+
+// StartEmbedded starts an anycable node handling WebSocket connections with
+// the given subprotocols, actioncable-v1-json by default.
+func StartEmbedded(server Server, subprotocols ...string) EmbeddedAnycable {
+	return StartEmbeddedWith(server, EmbeddedConfig{Subprotocols: subprotocols})
+}
+
+// StartEmbeddedWith starts an anycable node configured with config.
+func StartEmbeddedWith(server Server, config EmbeddedConfig) EmbeddedAnycable {
+	if len(config.Subprotocols) == 0 {
+		config.Subprotocols = []string{JSONSubprotocol}
+	}
+	if config.Headers == nil {
+		config.Headers = DefaultHeaders
+	}
 	controller := NewController(server)
 	metrics := metrics.NewMetrics(metrics.NewBasePrinter(), 15)
 	appNode := node.NewNode(controller, metrics)
@@ -49,34 +130,48 @@ func StartEmbedded(server Server) EmbeddedAnycable {
 	go disconnector.Run() // nolint:errcheck
 	appNode.SetDisconnector(disconnector)
 
-	headers := []string{"cookies"} // TODO: Make it configurable.
 	wsConfig := node.NewWSConfig() // TODO: Make it configurable.
+	sessions := NewHTTPSessions(controller)
+	websockets := newWSSessions()
 	return EmbeddedAnycable{
-		appNode: appNode,
-		metrics: metrics,
-		Handler: node.WebsocketHandler(appNode, headers, &wsConfig),
+		appNode:    appNode,
+		metrics:    metrics,
+		controller: controller,
+		websockets: websockets,
+		sessions:   sessions,
+		Handler:    websocketHandler(appNode, controller, websockets, sessions, config.Headers, &wsConfig, config.Subprotocols),
+		SSEHandler: SSEHandler(sessions, config.Headers),
 	}
 }
 
 type Controller struct {
 	server Server
+	// streams mirrors the streams sessions are subscribed to.
+	streams     *streamIndex
+	history     history.History
+	resumptions resumptions
 }
 
 func NewController(server Server) *Controller {
-	return &Controller{server}
+	return &Controller{
+		server:      server,
+		streams:     newStreamIndex(),
+		resumptions: resumptions{sessions: make(map[string]resumption)},
+	}
 }
 
 func (c *Controller) Shutdown() error {
 	return nil
 }
 
-// TODO: Make sure that everything is thread-safe in all methods below (test!).
+// The node calls the methods below concurrently; the server must be safe for
+// concurrent use.
 
 func (c *Controller) Authenticate(sid string, env *common.SessionEnv) (*common.ConnectResult, error) {
 	r, err := c.server.Connect(newContext(sid), &ConnectionRequest{
 		Path:    env.URL,
 		Headers: *env.Headers,
-		Env:     buildEnv(env),
+		Env:     buildEnv(sid, env),
 	})
 	if err != nil {
 		return nil, err
@@ -86,6 +181,7 @@ func (c *Controller) Authenticate(sid string, env *common.SessionEnv) (*common.C
 
 	if r.Env != nil {
 		reply.CState = r.Env.Cstate
+		reply.IState = r.Env.Istate
 	}
 
 	if r.Status.String() == "SUCCESS" {
@@ -97,45 +193,95 @@ func (c *Controller) Authenticate(sid string, env *common.SessionEnv) (*common.C
 }
 
 func (c *Controller) Subscribe(sid string, env *common.SessionEnv, id string, channel string) (*common.CommandResult, error) {
+	c.hold(sid, channel)
 	r, err := c.server.Command(newContext(sid), &CommandMessage{
 		Command:               "subscribe",
-		Env:                   buildChannelEnv(channel, env),
+		Env:                   buildChannelEnv(sid, channel, env),
 		Identifier:            channel,
 		ConnectionIdentifiers: id},
 	)
 
-	return c.parseCommandResponse(r, err)
+	res, err := c.parseCommandResponse(r, err)
+	c.streams.apply(sid, channel, res)
+	return res, err
+}
+
+// SubscribeAll subscribes the session to several channels at once. Servers
+// implementing BatchServer handle them in a single call; others get one
+// Subscribe per channel. Results and errors are in the order of channels.
+func (c *Controller) SubscribeAll(sid string, env *common.SessionEnv, id string, channels []string) ([]*common.CommandResult, []error) {
+	results := make([]*common.CommandResult, len(channels))
+	errs := make([]error, len(channels))
+	batch, ok := c.server.(BatchServer)
+	if !ok {
+		for i, channel := range channels {
+			results[i], errs[i] = c.Subscribe(sid, env, id, channel)
+		}
+		return results, errs
+	}
+
+	messages := make([]*CommandMessage, len(channels))
+	for i, channel := range channels {
+		messages[i] = &CommandMessage{
+			Command:               "subscribe",
+			Env:                   buildChannelEnv(sid, channel, env),
+			Identifier:            channel,
+			ConnectionIdentifiers: id,
+		}
+	}
+	responses, err := batch.CommandBatch(newContext(sid), messages)
+	for i, channel := range channels {
+		if i >= len(responses) {
+			errs[i] = err
+			if err == nil {
+				errs[i] = fmt.Errorf("no batch response for %s", channel)
+			}
+			continue
+		}
+		results[i], errs[i] = c.parseCommandResponse(responses[i], nil)
+		c.streams.apply(sid, channel, results[i])
+	}
+	return results, errs
 }
 
 func (c *Controller) Unsubscribe(sid string, env *common.SessionEnv, id string, channel string) (*common.CommandResult, error) {
 	r, err := c.server.Command(newContext(sid), &CommandMessage{
 		Command:               "unsubscribe",
-		Env:                   buildChannelEnv(channel, env),
+		Env:                   buildChannelEnv(sid, channel, env),
 		Identifier:            channel,
 		ConnectionIdentifiers: id,
 	})
-	return c.parseCommandResponse(r, err)
+	res, err := c.parseCommandResponse(r, err)
+	if err == nil {
+		// The node stops all streams of the channel when unsubscribing.
+		c.streams.unsubscribe(sid, "", channel)
+	}
+	c.streams.apply(sid, channel, res)
+	return res, err
 }
 
 func (c *Controller) Perform(sid string, env *common.SessionEnv, id string, channel string, data string) (*common.CommandResult, error) {
 	r, err := c.server.Command(newContext(sid), &CommandMessage{
 		Command:               "message",
-		Env:                   buildChannelEnv(channel, env),
+		Env:                   buildChannelEnv(sid, channel, env),
 		Identifier:            channel,
 		ConnectionIdentifiers: id,
 		Data:                  data,
 	})
 
-	return c.parseCommandResponse(r, err)
+	res, err := c.parseCommandResponse(r, err)
+	c.streams.apply(sid, channel, res)
+	return res, err
 }
 
 func (c *Controller) Disconnect(sid string, env *common.SessionEnv, id string, subscriptions []string) error {
+	c.streams.remove(sid)
 	r, err := c.server.Disconnect(newContext(sid), &DisconnectRequest{
 		Identifiers:   id,
 		Subscriptions: subscriptions,
 		Path:          env.URL,
 		Headers:       *env.Headers,
-		Env:           buildDisconnectEnv(env),
+		Env:           buildDisconnectEnv(sid, env),
 	})
 
 	if err != nil {
@@ -150,22 +296,22 @@ func (c *Controller) Disconnect(sid string, env *common.SessionEnv, id string, s
 }
 
 func newContext(sessionID string) context.Context {
-	return context.Background()
-	// TODO: I don't think we need it but verify it before production-ready.
-	// md := metadata.Pairs("sid", sessionID, "protov", ProtoVersions)
-	// return metadata.NewOutgoingContext(context.Background(), md)
+	return NewIncomingContext(context.Background(), sessionID, ProtoVersions)
 }
 
-func buildEnv(env *common.SessionEnv) *Env {
-	protoEnv := Env{Url: env.URL, Headers: *env.Headers}
+func buildEnv(sid string, env *common.SessionEnv) *Env {
+	protoEnv := Env{
+		Url:     env.URL,
+		Headers: *env.Headers,
+	}
 	if env.ConnectionState != nil {
 		protoEnv.Cstate = *env.ConnectionState
 	}
 	return &protoEnv
 }
 
-func buildDisconnectEnv(env *common.SessionEnv) *Env {
-	protoEnv := *buildEnv(env)
+func buildDisconnectEnv(sid string, env *common.SessionEnv) *Env {
+	protoEnv := *buildEnv(sid, env)
 
 	if env.ChannelStates == nil {
 		return &protoEnv
@@ -184,8 +330,8 @@ func buildDisconnectEnv(env *common.SessionEnv) *Env {
 	return &protoEnv
 }
 
-func buildChannelEnv(id string, env *common.SessionEnv) *Env {
-	protoEnv := *buildEnv(env)
+func buildChannelEnv(sid, id string, env *common.SessionEnv) *Env {
+	protoEnv := *buildEnv(sid, env)
 
 	if env.ChannelStates == nil {
 		return &protoEnv
@@ -0,0 +1,41 @@
+package anycable
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/anycable/anycable-go/utils"
+)
+
+// DefaultHeaders are the request headers passed on to connections by
+// default, the ones their accessors read. Names ending with "*" match all
+// headers starting with the rest of the name.
+var DefaultHeaders = []string{"cookie", "origin", "user-agent", "forwarded", "x-forwarded-*"}
+
+// FetchHeaders is utils.FetchHeaders matching names ending with "*" as
+// prefixes. Keys are lowercase.
+func FetchHeaders(r *http.Request, list []string) map[string]string {
+	var names, prefixes []string
+	for _, name := range list {
+		name = strings.ToLower(name)
+		if strings.HasSuffix(name, "*") {
+			prefixes = append(prefixes, strings.TrimSuffix(name, "*"))
+		} else {
+			names = append(names, name)
+		}
+	}
+	headers := utils.FetchHeaders(r, names)
+	if len(prefixes) == 0 {
+		return headers
+	}
+	for key, values := range r.Header {
+		key = strings.ToLower(key)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				headers[key] = values[0]
+				break
+			}
+		}
+	}
+	return headers
+}
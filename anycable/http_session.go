@@ -0,0 +1,400 @@
+package anycable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/anycable/anycable-go/node"
+	"github.com/apex/log"
+	nanoid "github.com/matoous/go-nanoid"
+)
+
+// maxQueuedMessages bounds messages waiting for an HTTP client to pick them
+// up; the oldest ones are dropped first.
+const maxQueuedMessages = 1024
+
+// HTTPSessions runs sessions of HTTP-based transports (e.g. Server-Sent
+// Events) and of protobuf WebSocket clients against the controller, playing
+// the part the node and its hub play for WebSocket sessions: it routes
+// commands and delivers broadcasts.
+type HTTPSessions struct {
+	controller node.Controller
+
+	mu       sync.RWMutex
+	sessions map[string]*HTTPSession
+	// streams is shared with the controller if it's a Controller, which
+	// keeps it up to date; otherwise the sessions keep their own.
+	streams       *streamIndex
+	sharedStreams bool
+}
+
+func NewHTTPSessions(controller node.Controller) *HTTPSessions {
+	sessions := &HTTPSessions{
+		controller: controller,
+		sessions:   make(map[string]*HTTPSession),
+		streams:    newStreamIndex(),
+	}
+	if c, ok := controller.(*Controller); ok {
+		sessions.streams = c.streams
+		sessions.sharedStreams = true
+	}
+	return sessions
+}
+
+// HTTPSession is a connection of an HTTP-based transport. Messages for the
+// client are queued until the transport picks them up.
+type HTTPSession struct {
+	UID string
+
+	sessions      *HTTPSessions
+	env           *common.SessionEnv
+	identifiers   string
+	subscriptions map[string]bool
+
+	// commands serializes calls to the controller, which read and update env.
+	commands sync.Mutex
+
+	mu     sync.Mutex
+	queue  [][]byte
+	ready  chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// NewSessionID generates a session ID. Unlike WebSocket sessions, HTTP ones
+// are looked up by ID on every request, so it's never taken from the client.
+func NewSessionID() (string, error) {
+	return nanoid.Nanoid()
+}
+
+// Open authenticates a new session. If authentication fails, the session
+// isn't registered but still holds the transmissions explaining why.
+func (s *HTTPSessions) Open(uid, url string, headers map[string]string) (*HTTPSession, error) {
+	if _, ok := s.Get(uid); ok {
+		return nil, fmt.Errorf("session %q already exists", uid)
+	}
+	session := &HTTPSession{
+		UID:           uid,
+		sessions:      s,
+		env:           common.NewSessionEnv(url, &headers),
+		subscriptions: make(map[string]bool),
+		ready:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	res, err := s.controller.Authenticate(uid, session.env)
+	if res != nil {
+		session.handleCallReply(res.ToCallResult())
+	}
+	if err != nil {
+		session.closed = true
+		close(session.done)
+		return session, err
+	}
+	session.identifiers = res.Identifier
+	s.mu.Lock()
+	s.sessions[uid] = session
+	s.mu.Unlock()
+	return session, nil
+}
+
+// Shutdown closes all sessions.
+func (s *HTTPSessions) Shutdown() {
+	s.mu.RLock()
+	sessions := make([]*HTTPSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.RUnlock()
+	for _, session := range sessions {
+		session.enqueue(disconnectMessage("server_restart", true))
+		session.Close()
+	}
+}
+
+func (s *HTTPSessions) Get(uid string) (*HTTPSession, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[uid]
+	return session, ok
+}
+
+// Broadcast delivers the message to sessions streaming from its stream.
+func (s *HTTPSessions) Broadcast(msg *common.StreamMessage) {
+	for _, subscriber := range s.streams.subscribers(msg.Stream) {
+		if session, ok := s.Get(subscriber.sid); ok {
+			session.enqueue(buildMessage(msg.Data, subscriber.identifier))
+		}
+	}
+}
+
+// RemoteDisconnect closes sessions with the connection identifiers.
+func (s *HTTPSessions) RemoteDisconnect(msg *common.RemoteDisconnectMessage) {
+	s.mu.RLock()
+	var matching []*HTTPSession
+	for _, session := range s.sessions {
+		if session.identifiers == msg.Identifier {
+			matching = append(matching, session)
+		}
+	}
+	s.mu.RUnlock()
+	for _, session := range matching {
+		session.enqueue(disconnectMessage("remote", msg.Reconnect))
+		session.Close()
+	}
+}
+
+func (s *HTTPSessions) remove(uid string) {
+	s.mu.Lock()
+	delete(s.sessions, uid)
+	s.mu.Unlock()
+	if !s.sharedStreams {
+		s.streams.remove(uid)
+	}
+}
+
+// Handle executes a subscribe, unsubscribe or message command.
+func (session *HTTPSession) Handle(msg *common.Message) error {
+	res, err := session.handle(msg)
+	if res != nil && res.Disconnect {
+		session.Close()
+	}
+	return err
+}
+
+func (session *HTTPSession) handle(msg *common.Message) (*common.CommandResult, error) {
+	session.commands.Lock()
+	defer session.commands.Unlock()
+	if session.isClosed() {
+		return nil, fmt.Errorf("session %q is closed", session.UID)
+	}
+	controller := session.sessions.controller
+	var res *common.CommandResult
+	var err error
+	switch msg.Command {
+	case "subscribe":
+		if session.subscribed(msg.Identifier) {
+			return nil, fmt.Errorf("already subscribed to %s", msg.Identifier)
+		}
+		if c, ok := controller.(*Controller); ok && c.expect(session.UID, msg) {
+			// Once the confirmation is queued.
+			defer c.resume(session.UID, session.enqueue)
+		}
+		res, err = controller.Subscribe(session.UID, session.env, session.identifiers, msg.Identifier)
+		if err == nil {
+			session.setSubscribed(msg.Identifier, true)
+		}
+	case "unsubscribe":
+		if !session.subscribed(msg.Identifier) {
+			return nil, fmt.Errorf("unknown subscription %s", msg.Identifier)
+		}
+		// Stop delivering broadcasts to the channel right away.
+		session.sessions.streams.unsubscribe(session.UID, "", msg.Identifier)
+		session.setSubscribed(msg.Identifier, false)
+		res, err = controller.Unsubscribe(session.UID, session.env, session.identifiers, msg.Identifier)
+	case "message":
+		if !session.subscribed(msg.Identifier) {
+			return nil, fmt.Errorf("unknown subscription %s", msg.Identifier)
+		}
+		res, err = controller.Perform(session.UID, session.env, session.identifiers, msg.Identifier, msg.Data)
+	default:
+		return nil, fmt.Errorf("unknown command: %s", msg.Command)
+	}
+	if res != nil {
+		session.handleCommandReply(msg.Identifier, res)
+	}
+	return res, err
+}
+
+// bulkSubscriber is implemented by controllers able to subscribe to several
+// channels in one call.
+type bulkSubscriber interface {
+	SubscribeAll(sid string, env *common.SessionEnv, id string, channels []string) ([]*common.CommandResult, []error)
+}
+
+// SubscribeAll subscribes the session to several channels, in a single call
+// to the controller if it supports it. Errors are in the order of identifiers.
+func (session *HTTPSession) SubscribeAll(identifiers []string) []error {
+	bulk, ok := session.sessions.controller.(bulkSubscriber)
+	if !ok {
+		errs := make([]error, len(identifiers))
+		for i, identifier := range identifiers {
+			errs[i] = session.Handle(&common.Message{Command: "subscribe", Identifier: identifier})
+		}
+		return errs
+	}
+	disconnect, errs := session.subscribeAll(bulk, identifiers)
+	if disconnect {
+		session.Close()
+	}
+	return errs
+}
+
+func (session *HTTPSession) subscribeAll(bulk bulkSubscriber, identifiers []string) (bool, []error) {
+	session.commands.Lock()
+	defer session.commands.Unlock()
+	errs := make([]error, len(identifiers))
+	if session.isClosed() {
+		for i := range errs {
+			errs[i] = fmt.Errorf("session %q is closed", session.UID)
+		}
+		return false, errs
+	}
+	var channels []string
+	var indices []int
+	requested := make(map[string]bool)
+	for i, identifier := range identifiers {
+		if session.subscribed(identifier) || requested[identifier] {
+			errs[i] = fmt.Errorf("already subscribed to %s", identifier)
+			continue
+		}
+		requested[identifier] = true
+		channels = append(channels, identifier)
+		indices = append(indices, i)
+	}
+	if len(channels) == 0 {
+		return false, errs
+	}
+	disconnect := false
+	results, batchErrs := bulk.SubscribeAll(session.UID, session.env, session.identifiers, channels)
+	for j, channel := range channels {
+		errs[indices[j]] = batchErrs[j]
+		if batchErrs[j] == nil {
+			session.setSubscribed(channel, true)
+		}
+		if res := results[j]; res != nil {
+			session.handleCommandReply(channel, res)
+			disconnect = disconnect || res.Disconnect
+		}
+	}
+	return disconnect, errs
+}
+
+// Next waits for messages queued for the client and returns them. It returns
+// nothing once the context is done or the session is closed and drained.
+func (session *HTTPSession) Next(ctx context.Context) [][]byte {
+	for {
+		session.mu.Lock()
+		if len(session.queue) > 0 {
+			messages := session.queue
+			session.queue = nil
+			session.mu.Unlock()
+			return messages
+		}
+		closed := session.closed
+		session.mu.Unlock()
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-session.ready:
+		case <-session.done:
+		}
+	}
+}
+
+// Done is closed when the session is closed.
+func (session *HTTPSession) Done() <-chan struct{} {
+	return session.done
+}
+
+// Close unregisters the session and runs the disconnect callbacks.
+func (session *HTTPSession) Close() {
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		return
+	}
+	session.closed = true
+	subscriptions := make([]string, 0, len(session.subscriptions))
+	for identifier := range session.subscriptions {
+		subscriptions = append(subscriptions, identifier)
+	}
+	close(session.done)
+	session.mu.Unlock()
+
+	session.sessions.remove(session.UID)
+	session.commands.Lock()
+	defer session.commands.Unlock()
+	err := session.sessions.controller.Disconnect(session.UID, session.env, session.identifiers, subscriptions)
+	if err != nil {
+		log.WithField("sid", session.UID).Errorf("Disconnect error: %v", err)
+	}
+}
+
+func (session *HTTPSession) isClosed() bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.closed
+}
+
+func (session *HTTPSession) subscribed(identifier string) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.subscriptions[identifier]
+}
+
+func (session *HTTPSession) setSubscribed(identifier string, subscribed bool) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if subscribed {
+		session.subscriptions[identifier] = true
+	} else {
+		delete(session.subscriptions, identifier)
+	}
+}
+
+func (session *HTTPSession) enqueue(msg []byte) {
+	session.mu.Lock()
+	if len(session.queue) >= maxQueuedMessages {
+		session.queue = session.queue[1:]
+	}
+	session.queue = append(session.queue, msg)
+	session.mu.Unlock()
+	select {
+	case session.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (session *HTTPSession) handleCommandReply(identifier string, reply *common.CommandResult) {
+	if sessions := session.sessions; !sessions.sharedStreams {
+		sessions.streams.apply(session.UID, identifier, reply)
+	}
+	if reply.IState != nil {
+		session.env.MergeChannelState(identifier, &reply.IState)
+	}
+	session.handleCallReply(reply.ToCallResult())
+}
+
+func (session *HTTPSession) handleCallReply(reply *common.CallResult) {
+	if reply.CState != nil {
+		session.env.MergeConnectionState(&reply.CState)
+	}
+	for _, msg := range reply.Transmissions {
+		session.enqueue([]byte(msg))
+	}
+}
+
+// buildMessage wraps broadcast data for a subscription like the node does.
+func buildMessage(data string, identifier string) []byte {
+	return (&common.Reply{Identifier: identifier, Message: decodeMessage(data)}).ToJSON()
+}
+
+func decodeMessage(data string) interface{} {
+	var msg interface{}
+	// We ignore JSON deserialization failures and consider the message to be a string
+	json.Unmarshal([]byte(data), &msg) // nolint:errcheck
+	if msg == nil {
+		msg = data
+	}
+	return msg
+}
+
+func disconnectMessage(reason string, reconnect bool) []byte {
+	return (&common.DisconnectMessage{Type: "disconnect", Reason: reason, Reconnect: reconnect}).ToJSON()
+}
@@ -0,0 +1,41 @@
+package anycable
+
+import (
+	context "context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// SessionIDMetadataKey carries the node's session id on every RPC call.
+	SessionIDMetadataKey = "sid"
+	// ProtocolVersionMetadataKey carries a comma-separated list of RPC
+	// protocol versions the calling node understands.
+	ProtocolVersionMetadataKey = "protov"
+	// ProtoVersions is the list of versions announced by the embedded node.
+	ProtoVersions = "v1"
+)
+
+// NewIncomingContext returns a context carrying the same metadata anycable-go
+// sends over gRPC, so in-process calls look like remote ones to the server.
+func NewIncomingContext(c context.Context, sessionID, protoVersions string) context.Context {
+	md := metadata.Pairs(SessionIDMetadataKey, sessionID, ProtocolVersionMetadataKey, protoVersions)
+	return metadata.NewIncomingContext(c, md)
+}
+
+// FromIncomingContext returns the session id and protocol versions sent by
+// the node. Both are empty if the caller didn't send any metadata.
+func FromIncomingContext(c context.Context) (sessionID, protoVersions string) {
+	md, ok := metadata.FromIncomingContext(c)
+	if !ok {
+		return "", ""
+	}
+	return first(md.Get(SessionIDMetadataKey)), first(md.Get(ProtocolVersionMetadataKey))
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
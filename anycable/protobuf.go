@@ -0,0 +1,159 @@
+package anycable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/anycable/anycable-go/utils"
+	"github.com/apex/log"
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+// JSONSubprotocol is the subprotocol of ActionCable clients.
+const JSONSubprotocol = "actioncable-v1-json"
+
+// ProtobufSubprotocol is the binary subprotocol described by actioncable.proto.
+const ProtobufSubprotocol = "actioncable-v1-protobuf"
+
+const (
+	protobufWriteWait    = 10 * time.Second
+	protobufPingInterval = 3 * time.Second
+)
+
+// protobufConn serves a client speaking ProtobufSubprotocol. The node only
+// speaks JSON, so the client gets an HTTPSession, like clients of HTTP-based
+// transports, and messages are transcoded as they're read and written.
+type protobufConn struct {
+	ws        *websocket.Conn
+	session   *HTTPSession
+	closeOnce sync.Once
+}
+
+func serveProtobuf(sessions *HTTPSessions, ws *websocket.Conn, url string, headers map[string]string) {
+	ctx := log.WithField("context", "ws")
+
+	uid, err := NewSessionID()
+	if err != nil {
+		utils.CloseWS(ws, websocket.CloseAbnormalClosure, "UID Retrieval Error")
+		return
+	}
+	session, err := sessions.Open(uid, url, headers)
+	if session == nil {
+		ctx.Errorf("Protobuf session initialization failed: %v", err)
+		utils.CloseWS(ws, websocket.CloseInternalServerErr, "Session Error")
+		return
+	}
+	c := &protobufConn{ws: ws, session: session}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.writeMessages()
+	}()
+	// If authentication failed, the session is already closed and only
+	// holds the messages telling the client why.
+	if err == nil {
+		c.readMessages()
+		session.Close()
+	}
+	<-written
+}
+
+// readMessages handles commands until the connection is closed or the
+// client sends a frame that isn't a valid command.
+func (c *protobufConn) readMessages() {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, err := decodeProtobufCommand(data)
+		if err != nil {
+			log.WithField("sid", c.session.UID).Debugf("Invalid protobuf command: %v", err)
+			c.close(websocket.CloseUnsupportedData, "Invalid Message")
+			return
+		}
+		if err := c.session.Handle(msg); err != nil {
+			log.WithField("sid", c.session.UID).Debugf("Protobuf command error: %v", err)
+		}
+	}
+}
+
+// writeMessages sends the messages queued for the client, pinging it while
+// there are none, and closes the connection once the session is closed.
+func (c *protobufConn) writeMessages() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), protobufPingInterval)
+		messages := c.session.Next(ctx)
+		cancel()
+		if messages == nil {
+			select {
+			case <-c.session.Done():
+				c.close(websocket.CloseNormalClosure, "")
+				return
+			default:
+				messages = [][]byte{pingMessage()}
+			}
+		}
+		for _, msg := range messages {
+			frame, err := encodeProtobufReply(msg)
+			if err != nil {
+				log.WithField("sid", c.session.UID).Errorf("Protobuf encoding error: %v", err)
+				c.close(websocket.CloseInternalServerErr, "Encoding Error")
+				return
+			}
+			c.ws.SetWriteDeadline(time.Now().Add(protobufWriteWait)) // nolint:errcheck
+			if err := c.ws.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "Write Failed")
+				return
+			}
+		}
+	}
+}
+
+func (c *protobufConn) close(code int, reason string) {
+	c.closeOnce.Do(func() { utils.CloseWS(c.ws, code, reason) })
+}
+
+func pingMessage() []byte {
+	return (&common.PingMessage{Type: "ping", Message: time.Now().Unix()}).ToJSON()
+}
+
+func decodeProtobufCommand(data []byte) (*common.Message, error) {
+	msg := ProtobufMessage{}
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Command == ProtobufCommand_unknown_command {
+		return nil, fmt.Errorf("unknown command %v", msg.Command)
+	}
+	return &common.Message{
+		Command:    msg.Command.String(),
+		Identifier: msg.Identifier,
+		Data:       msg.Data,
+	}, nil
+}
+
+func encodeProtobufReply(data []byte) ([]byte, error) {
+	var reply struct {
+		Type       string          `json:"type"`
+		Identifier string          `json:"identifier"`
+		Message    json.RawMessage `json:"message"`
+		Reason     string          `json:"reason"`
+		Reconnect  bool            `json:"reconnect"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&ProtobufMessage{
+		Type:       ProtobufType(ProtobufType_value[reply.Type]),
+		Identifier: reply.Identifier,
+		Message:    reply.Message,
+		Reason:     reply.Reason,
+		Reconnect:  reply.Reconnect,
+	})
+}
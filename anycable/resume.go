@@ -0,0 +1,143 @@
+package anycable
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/anycable/anycable-go/node"
+	"github.com/apex/log"
+	"github.com/bilus/activego/history"
+	"github.com/gorilla/websocket"
+)
+
+// subscribeData is the data of subscribe commands resuming streams, see the
+// package documentation.
+type subscribeData struct {
+	Offsets map[string]uint64 `json:"offsets"`
+}
+
+// offsetReply is common.Reply with the offset of the broadcast in the stream
+// history.
+type offsetReply struct {
+	Identifier string      `json:"identifier"`
+	Message    interface{} `json:"message"`
+	Stream     string      `json:"stream"`
+	Offset     uint64      `json:"offset"`
+}
+
+func buildOffsetMessage(data, identifier, stream string, offset uint64) []byte {
+	msg, _ := json.Marshal(&offsetReply{
+		Identifier: identifier,
+		Message:    decodeMessage(data),
+		Stream:     stream,
+		Offset:     offset,
+	})
+	return msg
+}
+
+// resumption is a subscribe command of a session resuming streams.
+type resumption struct {
+	identifier string
+	offsets    map[string]uint64
+}
+
+type resumptions struct {
+	mu       sync.Mutex
+	sessions map[string]resumption
+}
+
+// SetHistory sets the stream history subscriptions resume from, the one the
+// broadcaster records broadcasts in. It must be called before serving
+// clients.
+func (c *Controller) SetHistory(h history.History) {
+	c.history = h
+}
+
+// expect records the offsets of a subscribe command about to be handled for
+// the session, reporting whether it resumes streams. If so, resume must be
+// called once the command has been handled.
+func (c *Controller) expect(sid string, msg *common.Message) bool {
+	if c.history == nil || msg.Command != "subscribe" || msg.Data == "" {
+		return false
+	}
+	var data subscribeData
+	if err := json.Unmarshal([]byte(msg.Data), &data); err != nil || len(data.Offsets) == 0 {
+		return false
+	}
+	c.resumptions.mu.Lock()
+	defer c.resumptions.mu.Unlock()
+	c.resumptions.sessions[sid] = resumption{msg.Identifier, data.Offsets}
+	return true
+}
+
+// hold stops delivering broadcasts to the channel the session is subscribing
+// to from the streams it resumes until they're replayed.
+func (c *Controller) hold(sid, identifier string) {
+	c.resumptions.mu.Lock()
+	r, ok := c.resumptions.sessions[sid]
+	c.resumptions.mu.Unlock()
+	if ok && r.identifier == identifier {
+		c.streams.hold(sid, identifier, r.offsets)
+	}
+}
+
+// resume sends the session what it missed on the streams it resumes, then
+// delivers their broadcasts again.
+func (c *Controller) resume(sid string, send func([]byte)) {
+	c.resumptions.mu.Lock()
+	r, ok := c.resumptions.sessions[sid]
+	delete(c.resumptions.sessions, sid)
+	c.resumptions.mu.Unlock()
+	if !ok {
+		return
+	}
+	streams := make([]string, 0, len(r.offsets))
+	for stream := range r.offsets {
+		streams = append(streams, stream)
+	}
+	c.streams.resume(sid, r.identifier, streams, func(stream string, offset uint64) uint64 {
+		entries, err := c.history.Since(stream, offset)
+		if err != nil {
+			log.WithField("context", "history").WithError(err).Errorf("Failed to replay stream %s", stream)
+		}
+		for _, entry := range entries {
+			send(buildOffsetMessage(entry.Data, r.identifier, stream, entry.Offset))
+			offset = entry.Offset
+		}
+		return offset
+	})
+}
+
+var expectedCloseStatuses = []int{
+	websocket.CloseNormalClosure,
+	websocket.CloseGoingAway,
+	websocket.CloseNoStatusReceived,
+}
+
+// readMessages is node.Session.ReadMessages resuming streams once the node
+// has handled subscribe commands, see subscribeData.
+func readMessages(app *node.Node, controller *Controller, session *node.Session, ws *websocket.Conn) {
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, expectedCloseStatuses...) {
+				session.Log.Debugf("Websocket closed: %v", err)
+				session.Disconnect("Read closed", node.CloseNormalClosure)
+			} else {
+				session.Log.Debugf("Websocket close error: %v", err)
+				session.Disconnect("Read failed", node.CloseAbnormalClosure)
+			}
+			return
+		}
+
+		msg := &common.Message{}
+		resumes := json.Unmarshal(message, msg) == nil && controller.expect(session.UID, msg)
+		if err := app.HandleCommand(session, message); err != nil {
+			session.Log.Warnf("Failed to handle incoming message '%s' with error: %v", message, err)
+		}
+		if resumes {
+			controller.resume(session.UID, session.Send)
+		}
+	}
+}
@@ -800,8 +800,10 @@ var file_server_proto_rawDesc = []byte{
 	0x2e, 0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x2e, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x6e,
 	0x6e, 0x65, 0x63, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x61, 0x6e,
 	0x79, 0x63, 0x61, 0x62, 0x6c, 0x65, 0x2e, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63,
-	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x62, 0x06, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x33,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x24, 0x5a, 0x22, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x62, 0x69, 0x6c, 0x75, 0x73, 0x2f,
+	0x61, 0x63, 0x74, 0x69, 0x76, 0x65, 0x67, 0x6f, 0x2f, 0x61, 0x6e, 0x79, 0x63, 0x61, 0x62, 0x6c,
+	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
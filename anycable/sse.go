@@ -0,0 +1,141 @@
+package anycable
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/apex/log"
+)
+
+// sseKeepAlive is how often a comment is sent to keep idle streams open
+// through proxies.
+const sseKeepAlive = 15 * time.Second
+
+// SSEHandler serves clients that can't use WebSockets with Server-Sent Events.
+//
+// A GET request opens a session and streams ActionCable messages as events;
+// the first event, named "session", carries the session ID. Channels to
+// subscribe to right away are passed as `identifier` query params. A POST
+// request with the session ID in the `sid` query param sends a command
+// (subscribe, unsubscribe or message) in the body, as WebSocket clients do.
+func SSEHandler(sessions *HTTPSessions, fetchHeaders []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			serveEvents(sessions, fetchHeaders, w, r)
+		case http.MethodPost:
+			serveCommand(sessions, w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveEvents(sessions *HTTPSessions, fetchHeaders []string, w http.ResponseWriter, r *http.Request) {
+	ctx := log.WithField("context", "sse")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	uid, err := NewSessionID()
+	if err != nil {
+		http.Error(w, "UID Retrieval Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	session, err := sessions.Open(uid, RequestURL(r), FetchHeaders(r, fetchHeaders))
+	if session == nil {
+		ctx.Errorf("SSE session initialization failed: %v", err)
+		return
+	}
+	if err != nil {
+		ctx.Debugf("SSE session authentication failed: %v", err)
+		writeEvents(w, session.Next(r.Context()))
+		flusher.Flush()
+		return
+	}
+	defer session.Close()
+
+	sid, _ := json.Marshal(map[string]string{"sid": uid})
+	fmt.Fprintf(w, "event: session\ndata: %s\n\n", sid)
+	for _, err := range session.SubscribeAll(r.URL.Query()["identifier"]) {
+		if err != nil {
+			ctx.Debugf("SSE subscribe error: %v", err)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	messages := make(chan [][]byte)
+	go func() {
+		defer close(messages)
+		for {
+			batch := session.Next(r.Context())
+			if batch == nil {
+				return
+			}
+			messages <- batch
+		}
+	}()
+	for {
+		select {
+		case batch, ok := <-messages:
+			if !ok {
+				return
+			}
+			writeEvents(w, batch)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvents(w http.ResponseWriter, messages [][]byte) {
+	for _, msg := range messages {
+		fmt.Fprintf(w, "data: %s\n\n", msg)
+	}
+}
+
+func serveCommand(sessions *HTTPSessions, w http.ResponseWriter, r *http.Request) {
+	session, ok := sessions.Get(r.URL.Query().Get("sid"))
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	msg := common.Message{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "malformed command", http.StatusBadRequest)
+		return
+	}
+	if err := session.Handle(&msg); err != nil {
+		log.WithField("context", "sse").Debugf("SSE command error: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RequestURL returns the absolute URL of the request.
+func RequestURL(r *http.Request) string {
+	url := r.URL.String()
+	if !r.URL.IsAbs() {
+		// See https://github.com/golang/go/issues/28940#issuecomment-441749380
+		scheme := "http://"
+		if r.TLS != nil {
+			scheme = "https://"
+		}
+		url = fmt.Sprintf("%s%s%s", scheme, r.Host, url)
+	}
+	return url
+}
@@ -0,0 +1,226 @@
+package anycable
+
+import (
+	"sync"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/anycable/anycable-go/node"
+)
+
+// streamIndex maps streams to the sessions and channels streaming from them.
+// The node's hub keeps the same index for WebSocket sessions but doesn't
+// expose it, so the controller mirrors it from command results to deliver
+// broadcasts excluding a session or carrying their offset in the stream
+// history. HTTP sessions are delivered from it too.
+type streamIndex struct {
+	mu sync.RWMutex
+	// Map streams to session IDs to channel identifiers and, in reverse,
+	// session IDs to streams to channel identifiers, so that a session is
+	// removed without scanning all streams.
+	streams  map[string]map[string]map[string]bool
+	sessions map[string]map[string]map[string]bool
+	// cursors holds the position in the stream history of links resuming
+	// the stream, see Controller.resume.
+	cursors map[link]*cursor
+}
+
+func newStreamIndex() *streamIndex {
+	return &streamIndex{
+		streams:  make(map[string]map[string]map[string]bool),
+		sessions: make(map[string]map[string]map[string]bool),
+		cursors:  make(map[link]*cursor),
+	}
+}
+
+// subscriber is a channel of a session streaming from a stream.
+type subscriber struct {
+	sid        string
+	identifier string
+}
+
+type link struct {
+	subscriber
+	stream string
+}
+
+// cursor is the last offset of a stream sent to a link. Broadcasts up to it
+// have been replayed, and none are delivered while the link is held.
+type cursor struct {
+	offset uint64
+	held   bool
+}
+
+// apply updates the index with a command result the way the node does.
+func (idx *streamIndex) apply(sid, identifier string, res *common.CommandResult) {
+	if res == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if res.StopAllStreams {
+		idx.unlinkAll(sid, identifier)
+	} else {
+		for _, stream := range res.StoppedStreams {
+			idx.unlink(sid, stream, identifier)
+		}
+	}
+	for _, stream := range res.Streams {
+		idx.link(sid, stream, identifier)
+	}
+}
+
+// unsubscribe stops streaming to the session's channel from the stream or,
+// if stream is empty, from all streams.
+func (idx *streamIndex) unsubscribe(sid, stream, identifier string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if stream == "" {
+		idx.unlinkAll(sid, identifier)
+	} else {
+		idx.unlink(sid, stream, identifier)
+	}
+}
+
+func (idx *streamIndex) remove(sid string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for stream, identifiers := range idx.sessions[sid] {
+		for identifier := range identifiers {
+			unset(idx.streams, stream, sid, identifier)
+			delete(idx.cursors, link{subscriber{sid, identifier}, stream})
+		}
+	}
+	delete(idx.sessions, sid)
+}
+
+func (idx *streamIndex) subscribers(stream string) []subscriber {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var subscribers []subscriber
+	for sid, identifiers := range idx.streams[stream] {
+		for identifier := range identifiers {
+			subscribers = append(subscribers, subscriber{sid, identifier})
+		}
+	}
+	return subscribers
+}
+
+// subscribersAt returns the subscribers of the stream due a broadcast with
+// the offset: those not held nor already sent it.
+func (idx *streamIndex) subscribersAt(stream string, offset uint64) []subscriber {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var subscribers []subscriber
+	for sid, identifiers := range idx.streams[stream] {
+		for identifier := range identifiers {
+			s := subscriber{sid, identifier}
+			if c, ok := idx.cursors[link{s, stream}]; ok && (c.held || offset <= c.offset) {
+				continue
+			}
+			subscribers = append(subscribers, s)
+		}
+	}
+	return subscribers
+}
+
+// hold stops delivering broadcasts to the session's channel from the streams
+// until it's resumed from the offsets.
+func (idx *streamIndex) hold(sid, identifier string, offsets map[string]uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for stream, offset := range offsets {
+		idx.cursors[link{subscriber{sid, identifier}, stream}] = &cursor{offset: offset, held: true}
+	}
+}
+
+// resume releases the streams held for the session's channel once replay has
+// sent what they missed, returning the last offset it sent. Holding the lock
+// in the meantime, no broadcast can get ahead of the replayed ones.
+func (idx *streamIndex) resume(sid, identifier string, streams []string, replay func(stream string, offset uint64) uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, stream := range streams {
+		l := link{subscriber{sid, identifier}, stream}
+		c, ok := idx.cursors[l]
+		if !ok || !c.held {
+			continue
+		}
+		if !idx.streams[stream][sid][identifier] {
+			// The channel doesn't stream from it.
+			delete(idx.cursors, l)
+			continue
+		}
+		c.offset = replay(stream, c.offset)
+		c.held = false
+	}
+}
+
+func (idx *streamIndex) link(sid, stream, identifier string) {
+	set(idx.streams, stream, sid, identifier)
+	set(idx.sessions, sid, stream, identifier)
+}
+
+func (idx *streamIndex) unlink(sid, stream, identifier string) {
+	unset(idx.streams, stream, sid, identifier)
+	unset(idx.sessions, sid, stream, identifier)
+	delete(idx.cursors, link{subscriber{sid, identifier}, stream})
+}
+
+// unlinkAll stops streaming to the session's channel from all streams.
+func (idx *streamIndex) unlinkAll(sid, identifier string) {
+	for stream, identifiers := range idx.sessions[sid] {
+		if identifiers[identifier] {
+			idx.unlink(sid, stream, identifier)
+		}
+	}
+}
+
+func set(m map[string]map[string]map[string]bool, a, b, c string) {
+	if _, ok := m[a]; !ok {
+		m[a] = make(map[string]map[string]bool)
+	}
+	if _, ok := m[a][b]; !ok {
+		m[a][b] = make(map[string]bool)
+	}
+	m[a][b][c] = true
+}
+
+// unset removes c from m[a][b], dropping maps left empty.
+func unset(m map[string]map[string]map[string]bool, a, b, c string) {
+	delete(m[a][b], c)
+	if len(m[a][b]) == 0 {
+		delete(m[a], b)
+	}
+	if len(m[a]) == 0 {
+		delete(m, a)
+	}
+}
+
+// wsSessions holds the WebSocket sessions of the embedded node by ID.
+type wsSessions struct {
+	mu       sync.RWMutex
+	sessions map[string]*node.Session
+}
+
+func newWSSessions() *wsSessions {
+	return &wsSessions{sessions: make(map[string]*node.Session)}
+}
+
+func (s *wsSessions) add(session *node.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.UID] = session
+}
+
+func (s *wsSessions) remove(uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, uid)
+}
+
+func (s *wsSessions) get(uid string) (*node.Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[uid]
+	return session, ok
+}
@@ -0,0 +1,73 @@
+package anycable
+
+import (
+	"net/http"
+
+	"github.com/anycable/anycable-go/node"
+	"github.com/anycable/anycable-go/utils"
+	"github.com/apex/log"
+	"github.com/gorilla/websocket"
+)
+
+// websocketHandler is node.WebsocketHandler accepting custom subprotocols.
+// Clients negotiating ProtobufSubprotocol get an HTTPSession of sessions.
+func websocketHandler(app *node.Node, controller *Controller, websockets *wsSessions, sessions *HTTPSessions, fetchHeaders []string, config *node.WSConfig, subprotocols []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := log.WithField("context", "ws")
+
+		upgrader := websocket.Upgrader{
+			CheckOrigin:       func(r *http.Request) bool { return true },
+			Subprotocols:      subprotocols,
+			ReadBufferSize:    config.ReadBufferSize,
+			WriteBufferSize:   config.WriteBufferSize,
+			EnableCompression: config.EnableCompression,
+		}
+
+		rheader := map[string][]string{"X-AnyCable-Version": {utils.Version()}}
+		ws, err := upgrader.Upgrade(w, r, rheader)
+		if err != nil {
+			ctx.Debugf("Websocket connection upgrade error: %#v", err.Error())
+			return
+		}
+
+		url := RequestURL(r)
+
+		headers := FetchHeaders(r, fetchHeaders)
+
+		uid, err := utils.FetchUID(r)
+		if err != nil {
+			utils.CloseWS(ws, websocket.CloseAbnormalClosure, "UID Retrieval Error")
+			return
+		}
+
+		ws.SetReadLimit(config.MaxMessageSize)
+
+		if config.EnableCompression {
+			ws.EnableWriteCompression(true)
+		}
+
+		if ws.Subprotocol() == ProtobufSubprotocol {
+			go serveProtobuf(sessions, ws, url, headers)
+			return
+		}
+
+		// Separate goroutine for better GC of caller's data.
+		go func() {
+			session, err := node.NewSession(app, ws, url, headers, uid)
+
+			if err != nil {
+				ctx.Errorf("Websocket session initialization failed: %v", err)
+				return
+			}
+
+			session.Log.Debug("websocket session established")
+
+			websockets.add(session)
+			defer websockets.remove(session.UID)
+
+			readMessages(app, controller, session, ws)
+
+			session.Log.Debug("websocket session completed")
+		}()
+	})
+}
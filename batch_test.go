@@ -0,0 +1,132 @@
+package activego_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func subscribeMessages(n int) []*anycable.CommandMessage {
+	messages := make([]*anycable.CommandMessage, n)
+	for i := range messages {
+		messages[i] = &anycable.CommandMessage{
+			Command:               "subscribe",
+			Identifier:            fmt.Sprintf(`{"channel":"RoomChannel","id":%d}`, i),
+			ConnectionIdentifiers: `{"user":"john"}`,
+			Env:                   &anycable.Env{Cstate: map[string]string{"visits": "0"}},
+		}
+	}
+	return messages
+}
+
+func buildRoomServer() *activego.ServerBuilder {
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			ch.StreamFrom(fmt.Sprintf("room:%v", ch.Param("id")))
+			return c.State().UpdateFloat64("visits", func(n float64) float64 { return n + 1 })
+		})
+	return server
+}
+
+func TestServer_CommandBatch(t *testing.T) {
+	require := require.New(t)
+
+	server := buildRoomServer()
+	responses, err := server.CommandBatch(context.Background(), subscribeMessages(3))
+	require.NoError(err)
+	require.Len(responses, 3)
+	for i, r := range responses {
+		require.Equal(anycable.Status_SUCCESS, r.Status)
+		require.Equal([]string{fmt.Sprintf("room:%d", i)}, r.Streams)
+	}
+	require.Equal("3", responses[2].Env.Cstate["visits"])
+}
+
+func TestServer_CommandBatch_OneConnection(t *testing.T) {
+	require := require.New(t)
+
+	subscribed := 0
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			subscribed++
+			return nil
+		})
+	messages := subscribeMessages(2)
+	messages[1].ConnectionIdentifiers = `{"user":"jane"}`
+
+	_, err := server.CommandBatch(context.Background(), messages)
+	require.Error(err)
+	// No command runs unless all belong to the connection.
+	require.Equal(0, subscribed)
+}
+
+func TestServer_CommandBatch_PartialResponses(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			if ch.Param("id") == float64(1) {
+				// State that can't be encoded fails the call.
+				c.State().Set("broken", make(chan int))
+			}
+			return nil
+		})
+	responses, err := server.CommandBatch(context.Background(), subscribeMessages(3))
+	require.Error(err)
+	require.Len(responses, 1)
+	require.Equal(anycable.Status_SUCCESS, responses[0].Status)
+}
+
+func TestServer_CommandBatch_StopsAfterDisconnect(t *testing.T) {
+	require := require.New(t)
+
+	subscribed := 0
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			subscribed++
+			return c.Close("banned", false)
+		})
+	responses, err := server.CommandBatch(context.Background(), subscribeMessages(3))
+	require.NoError(err)
+	require.Len(responses, 3)
+	require.True(responses[0].Disconnect)
+	for _, r := range responses[1:] {
+		require.Equal(anycable.Status_FAILURE, r.Status)
+		require.Empty(r.Transmissions)
+	}
+	require.Equal(1, subscribed)
+}
+
+func BenchmarkServer_Command_Subscribe10(b *testing.B) {
+	server := buildRoomServer()
+	messages := subscribeMessages(10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range messages {
+			if _, err := server.Command(context.Background(), m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkServer_CommandBatch_Subscribe10(b *testing.B) {
+	server := buildRoomServer()
+	messages := subscribeMessages(10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := server.CommandBatch(context.Background(), messages); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
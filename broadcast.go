@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 
 	"github.com/anycable/anycable-go/common"
+	"github.com/bilus/activego/anycable"
+	"github.com/bilus/activego/history"
 )
 
 type BroadcastAdapter interface {
@@ -12,20 +14,67 @@ type BroadcastAdapter interface {
 
 type Broadcaster struct {
 	adapter BroadcastAdapter
+	history history.History
+	codec   Codec
 }
 
 func NewBroadcaster(adapter BroadcastAdapter) *Broadcaster {
-	return &Broadcaster{adapter}
+	return &Broadcaster{adapter: adapter, codec: DefaultCodec}
+}
+
+// SetCodec sets the codec broadcast data is encoded with.
+func (b *Broadcaster) SetCodec(codec Codec) {
+	b.codec = codec
+}
+
+// SetHistory makes the broadcaster record every broadcast so that clients
+// can resume streams. Messages are sent along with their offset in the stream
+// history, which the embedded node passes on to clients.
+func (b *Broadcaster) SetHistory(h history.History) {
+	b.history = h
 }
 
 func (b *Broadcaster) Broadcast(stream string, data interface{}) error {
-	bs, err := json.Marshal(&data)
+	return b.broadcast(stream, data, nil, true)
+}
+
+// BroadcastWithMeta broadcasts data along with delivery options understood by
+// AnyCable 1.4+, e.g. excluding the sender's socket. Adapters that can't honour
+// them deliver the message to every subscriber.
+func (b *Broadcaster) BroadcastWithMeta(stream string, data interface{}, meta *anycable.BroadcastMeta) error {
+	return b.broadcast(stream, data, meta, true)
+}
+
+// broadcast sends data to the stream, recording it in history unless record
+// is false, as for whispers and disconnect commands, which clients shouldn't
+// get again when resuming.
+func (b *Broadcaster) broadcast(stream string, data interface{}, meta *anycable.BroadcastMeta, record bool) error {
+	bs, err := b.codec.Marshal(&data)
 	if err != nil {
 		return err
 	}
+	if b.history == nil || !record {
+		return b.send(stream, string(bs), meta, 0)
+	}
+	offset, err := b.history.Append(stream, string(bs))
+	if err != nil {
+		return err
+	}
+	return b.send(stream, string(bs), meta, offset)
+}
+
+func (b *Broadcaster) send(stream string, data string, meta *anycable.BroadcastMeta, offset uint64) error {
+	if meta != nil || offset != 0 {
+		return b.adapter.BroadcastRaw(&anycable.Broadcast{
+			Stream: stream,
+			Data:   data,
+			Meta:   meta,
+			Offset: offset,
+		})
+	}
 	return b.adapter.BroadcastRaw(common.StreamMessage{
 		Stream: stream,
-		Data:   string(bs),
+		Data:   data,
 	})
 }
 
@@ -2,30 +2,62 @@ package activego
 
 import (
 	context "context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/apex/log"
 	"github.com/bilus/activego/adapters"
 	"github.com/bilus/activego/anycable"
+	"github.com/bilus/activego/history"
 )
 
 type ConnectedHandler func(Connection) error
 type DisconnectedHandler func(Connection) error
 
+// connectionHandlers are the handlers registered with a ServerBuilder. They
+// are shared by all requests and never modified once the server has started.
+type connectionHandlers struct {
+	connected       ConnectedHandler
+	disconnected    DisconnectedHandler
+	beforeConnect   []ConnectionCallback
+	afterDisconnect []ConnectionCallback
+	// Callbacks and error handlers of all channels.
+	channelCallbacks
+	rescuers      []rescuer
+	errorHandler  ErrorHandler
+	missingAction MissingActionPolicy
+
+	// Channels registered by name, by pattern and for unknown channels.
+	channels map[string]*channelHandlers
+	routes   []channelRoute
+	fallback *channelHandlers
+}
+
+// ConnectionController runs the registered handlers for a connection. A new
+// one is created for every request.
 type ConnectionController struct {
 	Connection
 
-	connected    ConnectedHandler
-	disconnected DisconnectedHandler
-
-	channels map[string]*ChannelController
+	handlers *connectionHandlers
 }
 
 func (c ConnectionController) HandleOpen() error {
-	err := c.Connection.HandleOpen()
-	if err != nil {
+	// Connections rejected by callbacks aren't welcomed.
+	halt := runConnectionCallbacks(c.handlers.beforeConnect, c.Connection)
+	if halted(halt) != nil {
+		return halt
+	}
+	if err := c.Connection.HandleOpen(); err != nil {
 		return err
 	}
-	return c.connected(c.Connection)
+	if halt != nil {
+		return nil
+	}
+	return c.handlers.connected(c.Connection)
 }
 
 func (c ConnectionController) HandleClose(subscriptions []string) error {
@@ -33,140 +65,523 @@ func (c ConnectionController) HandleClose(subscriptions []string) error {
 	if err != nil {
 		return err
 	}
-	return c.disconnected(c.Connection)
+	if err := c.handlers.disconnected(c.Connection); err != nil {
+		return err
+	}
+	return halted(runConnectionCallbacks(c.handlers.afterDisconnect, c.Connection))
 }
 
 type SubscribedHandler func(Connection, Channel) error
 type UnsubscribedHandler func(Connection, Channel) error
 type ActionHandler func(Connection, Channel, ActionData) error
 
-type ChannelController struct {
-	Channel
-
-	connection Connection
+// channelHandlers are the handlers registered with a ChannelBuilder.
+type channelHandlers struct {
+	// key identifies the registration, i.e. the channel name or pattern.
+	// Rate limits and whisper policies are registered under it.
+	key string
 
 	subscribed     SubscribedHandler
 	unsubscribed   UnsubscribedHandler
 	actionHandlers map[string]ActionHandler
+	params         *paramsSchema
+	channelCallbacks
+	rescuers []rescuer
+
+	// typ is the struct type registered with ChannelBuilder.Type, if any.
+	typ *structType
+	// perform handles actions without a handler, see ReceivedAny.
+	perform AnyActionHandler
+}
+
+// ChannelController runs the registered handlers for a channel. A new one is
+// created for every command.
+type ChannelController struct {
+	Channel
+
+	connection Connection
+	handlers   *channelHandlers
+	// server holds callbacks and error handlers of all channels.
+	server *connectionHandlers
+	// paramsErr is the error decoding params, checked on subscribe.
+	paramsErr error
 }
 
 func (c ChannelController) HandleSubscribe() error {
-	return c.subscribed(c.connection, c.Channel)
+	err := runCallbacks(c.server.beforeSubscribe, c.handlers.beforeSubscribe, c.connection, c.Channel)
+	if err == nil {
+		err = c.handlers.subscribed(c.connection, c.Channel)
+	}
+	if err == nil {
+		err = runCallbacks(c.server.afterSubscribe, c.handlers.afterSubscribe, c.connection, c.Channel)
+	}
+	return halted(err)
 }
 
 func (c ChannelController) HandleUnsubscribe() error {
-	return c.unsubscribed(c.connection, c.Channel)
+	err := runCallbacks(c.server.beforeUnsubscribe, c.handlers.beforeUnsubscribe, c.connection, c.Channel)
+	if err == nil {
+		err = c.handlers.unsubscribed(c.connection, c.Channel)
+	}
+	if err == nil {
+		err = runCallbacks(c.server.afterUnsubscribe, c.handlers.afterUnsubscribe, c.connection, c.Channel)
+	}
+	return halted(err)
 }
 
 func (c ChannelController) HandleAction(action string, data ActionData) error {
-	handler, ok := c.actionHandlers[action]
-	if !ok {
-		return fmt.Errorf("missing action %q for channel %q", action, c.Channel.Identifier().Channel)
+	handler, err := c.actionHandler(action)
+	if err != nil {
+		return err
+	}
+	err = runPerformCallbacks(c.server.beforePerform, c.handlers.beforePerform, c.connection, c.Channel, action, data)
+	if err == nil {
+		err = handler(c.connection, c, data)
+	}
+	if err == nil {
+		err = runPerformCallbacks(c.server.afterPerform, c.handlers.afterPerform, c.connection, c.Channel, action, data)
+	}
+	return halted(err)
+}
+
+func (c ChannelController) actionHandler(action string) (ActionHandler, error) {
+	if handler, ok := c.handlers.actionHandlers[action]; ok {
+		return handler, nil
 	}
-	return handler(c.connection, c, data)
+	if c.handlers.perform != nil {
+		return func(connection Connection, _ Channel, data ActionData) error {
+			return c.handlers.perform(connection, c.Channel, action, data)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w %q for channel %q", ErrUnknownAction, action, c.Channel.Name())
 }
 
+// ServerBuilder registers handlers and configures the server. Registrations
+// are frozen once the server starts handling calls; registering handlers
+// afterwards panics.
 type ServerBuilder struct {
 	*Server
-	connectionController ConnectionController
+	handlers     *connectionHandlers
+	history      history.History
+	subprotocols []string
+	headers      []string
+	// Dependencies and the type registered with ConnectionType.
+	container      *container
+	connectionType *structType
+
+	mu     sync.Mutex
+	frozen int32
+	// Problems found while registering, reported by Build and Start.
+	problems []error
+}
+
+// NewServerBuilder returns a builder for a server whose broadcaster is set
+// with UseBroadcaster or, when embedded, by Start.
+func NewServerBuilder() *ServerBuilder {
+	return BuildServer(nil)
 }
 
 func BuildServer(broadcaster *Broadcaster) *ServerBuilder {
 	builder := &ServerBuilder{
-
-		connectionController: ConnectionController{
-			Connection:   nil,
+		handlers: &connectionHandlers{
 			connected:    func(Connection) error { return nil },
 			disconnected: func(Connection) error { return nil },
-			channels:     make(map[string]*ChannelController),
+			channels:     make(map[string]*channelHandlers),
 		},
+		container: &container{},
 	}
 	builder.Server = NewServer(
 		func(
 			c context.Context,
+			md RequestMetadata,
 			env *anycable.Env,
 			socket *Socket,
 			broadcaster *Broadcaster,
 			channelFactory ChannelFactory,
 			identifiers ConnectionIdentifiers) (Connection, error) {
 
-			controller := builder.connectionController
-			var err error
-			controller.Connection, err = NewStatelessConnection(c, env, socket, broadcaster, channelFactory, identifiers)
+			builder.freeze()
+			connection, err := NewStatelessConnection(md, env, socket, broadcaster, channelFactory, identifiers)
 			if err != nil {
 				return nil, err
 			}
-			return controller, nil
+			return &ConnectionController{
+				Connection: connection,
+				handlers:   builder.handlers,
+			}, nil
 		},
 		func(connection Connection,
-			identifierJSON string,
+			identifier ChannelIdentifier,
 			socket *Socket,
 			broadcaster *Broadcaster) (Channel, error) {
 
-			identifier := ChannelIdentifier{}
-			if err := identifier.Unmarshal([]byte(identifierJSON)); err != nil {
-				return nil, err
-			}
-			controller, ok := builder.connectionController.channels[identifier.Channel]
+			builder.freeze()
+			handlers, ok := builder.handlers.route(identifier.Name())
 			if !ok {
-				return nil, fmt.Errorf("missing channel %q", identifier.Channel)
+				return nil, fmt.Errorf("%w %q", ErrUnknownChannel, identifier.Name())
 			}
-			controller.connection = connection
-			var err error
-			controller.Channel, err = NewStatelessChannel(identifierJSON, socket, broadcaster)
-			if err != nil {
-				return nil, err
+			channel := NewStatelessChannel(identifier, socket, broadcaster)
+			var paramsErr error
+			if handlers.params != nil {
+				channel.params, paramsErr = handlers.params.decode(identifier)
 			}
-			return controller, nil
+			return &ChannelController{
+				Channel:    channel,
+				connection: connection,
+				handlers:   handlers,
+				server:     builder.handlers,
+				paramsErr:  paramsErr,
+			}, nil
 		},
 		broadcaster)
+	builder.Server.routeKey = func(channel string) string {
+		if handlers, ok := builder.handlers.route(channel); ok {
+			return handlers.key
+		}
+		return channel
+	}
 
 	return builder
 }
 
+// freeze stops further registrations. Calls handled afterwards only read
+// the handlers, so they need no locking.
+func (b *ServerBuilder) freeze() {
+	if atomic.LoadInt32(&b.frozen) == 1 {
+		return
+	}
+	b.mu.Lock()
+	atomic.StoreInt32(&b.frozen, 1)
+	atomic.StoreInt32(&b.Server.sealed, 1)
+	b.mu.Unlock()
+}
+
+// register applies a registration unless the server has already started.
+func (b *ServerBuilder) register(f func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if atomic.LoadInt32(&b.frozen) == 1 {
+		panic("activego: server configured after it started handling calls")
+	}
+	f()
+}
+
+// UseBroadcaster sets the broadcaster of a standalone server.
+func (b *ServerBuilder) UseBroadcaster(broadcaster *Broadcaster) *ServerBuilder {
+	b.register(func() {
+		broadcaster.SetHistory(b.history)
+		broadcaster.SetCodec(b.Server.codec)
+		b.Server.SetBroadcaster(broadcaster)
+	})
+	return b
+}
+
 func (b *ServerBuilder) Connected(f ConnectedHandler) *ServerBuilder {
-	b.connectionController.connected = f
+	b.register(func() { b.handlers.connected = f })
 	return b
 }
 
 func (b *ServerBuilder) Disconnected(f DisconnectedHandler) *ServerBuilder {
-	b.connectionController.disconnected = f
+	b.register(func() { b.handlers.disconnected = f })
 	return b
 }
 
-func (b *ServerBuilder) MakeEmbedded() anycable.EmbeddedAnycable {
-	a := anycable.StartEmbedded(b.Server)
-	b.Server.SetBroadcaster(NewBroadcaster(adapters.NewEmbeddedBroadcastAdapter(a)))
+// RateLimit limits how often a connection may perform actions on any channel.
+func (b *ServerBuilder) RateLimit(limit RateLimit) *ServerBuilder {
+	b.register(func() { b.Server.connectionRateLimit = newRateLimit(limit) })
+	return b
+}
+
+// StreamHistory keeps broadcasts in h so that clients can resume streams
+// after reconnecting, passing the last offsets they've seen when subscribing
+// (see package anycable). Only the embedded node resumes streams.
+func (b *ServerBuilder) StreamHistory(h history.History) *ServerBuilder {
+	b.register(func() {
+		b.history = h
+		if b.Server.Broadcaster != nil {
+			b.Server.Broadcaster.SetHistory(h)
+		}
+	})
+	return b
+}
+
+// UseCodec sets the codec used for transmissions and broadcasts, e.g.
+// JSONCodec{UseNumber: true}. Nodes pass them on to clients as
+// actioncable-v1-json, so the codec must encode JSON and report it by
+// implementing JSONEncoder; other codecs are reported as a problem.
+func (b *ServerBuilder) UseCodec(codec Codec) *ServerBuilder {
+	b.register(func() {
+		if encoder, ok := codec.(JSONEncoder); !ok || !encoder.EncodesJSON() {
+			b.problems = append(b.problems, fmt.Errorf("%T doesn't encode JSON, so it can only encode state, see UseStateCodec", codec))
+			return
+		}
+		b.Server.codec = codec
+		if b.Server.Broadcaster != nil {
+			b.Server.Broadcaster.SetCodec(codec)
+		}
+	})
+	return b
+}
+
+// UseStateCodec sets the codec used for connection and channel state.
+func (b *ServerBuilder) UseStateCodec(codec Codec) *ServerBuilder {
+	b.register(func() { b.Server.stateCodec = codec })
+	return b
+}
+
+// AcceptProtobuf lets the embedded WebSocket handler also serve clients
+// speaking the binary actioncable-v1-protobuf subprotocol (see
+// anycable/actioncable.proto).
+func (b *ServerBuilder) AcceptProtobuf() *ServerBuilder {
+	b.register(func() { b.subprotocols = append(b.subprotocols, anycable.ProtobufSubprotocol) })
+	return b
+}
+
+// ForwardHeaders sets the request headers the embedded node passes on to
+// connections, anycable.DefaultHeaders by default. Names ending with "*"
+// match all headers starting with the rest of the name, e.g. "x-forwarded-*".
+func (b *ServerBuilder) ForwardHeaders(headers ...string) *ServerBuilder {
+	b.register(func() { b.headers = append([]string{}, headers...) })
+	return b
+}
+
+// Build validates the configuration of a standalone server (see Serve) and
+// returns the server. The configuration can't be changed afterwards.
+func (b *ServerBuilder) Build() (*Server, error) {
+	if err := b.validate(false); err != nil {
+		return nil, err
+	}
+	b.freeze()
+	return b.Server, nil
+}
+
+// Start validates the configuration and starts an embedded anycable node
+// serving the channels. The configuration can't be changed afterwards.
+func (b *ServerBuilder) Start() (anycable.EmbeddedAnycable, error) {
+	if err := b.validate(true); err != nil {
+		return anycable.EmbeddedAnycable{}, err
+	}
+	return b.start(), nil
+}
+
+func (b *ServerBuilder) start() anycable.EmbeddedAnycable {
+	a := anycable.StartEmbeddedWith(b.Server, anycable.EmbeddedConfig{
+		Subprotocols: append([]string{anycable.JSONSubprotocol}, b.subprotocols...),
+		Headers:      b.headers,
+	})
+	broadcaster := NewBroadcaster(adapters.NewEmbeddedBroadcastAdapter(a))
+	broadcaster.SetHistory(b.history)
+	broadcaster.SetCodec(b.Server.codec)
+	b.Server.SetBroadcaster(broadcaster)
+	a.SetHistory(b.history)
+	b.freeze()
 	return a
 }
 
+// MakeEmbedded is like Start but only logs problems with the configuration.
+//
+// Deprecated: Use Start.
+func (b *ServerBuilder) MakeEmbedded() anycable.EmbeddedAnycable {
+	if err := b.validate(true); err != nil {
+		log.WithError(err).Warn("Starting with an invalid configuration")
+	}
+	return b.start()
+}
+
+// ConfigError lists the problems found validating a server configuration.
+type ConfigError struct {
+	Problems []error
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Error()
+	}
+	return "invalid server configuration: " + strings.Join(messages, "; ")
+}
+
+// reservedActions are names of subscription commands and callbacks. As in
+// ActionCable, clients can't perform them as actions.
+var reservedActions = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"subscribed":   true,
+	"unsubscribed": true,
+}
+
+func (b *ServerBuilder) validate(embedded bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	problems := append([]error(nil), b.problems...)
+	if !embedded && b.Server.Broadcaster == nil {
+		problems = append(problems, errors.New("missing broadcaster"))
+	}
+	if b.connectionType != nil {
+		problems = append(problems, b.connectionType.unresolved()...)
+	}
+	for _, handlers := range b.handlers.registered() {
+		if handlers.typ != nil {
+			problems = append(problems, handlers.typ.unresolved()...)
+		}
+		if _, ok := b.whispers[handlers.key]; !ok {
+			continue
+		}
+		if _, ok := handlers.actionHandlers[WhisperAction]; ok {
+			problems = append(problems, fmt.Errorf("channel %q both allows whispering and handles the %q action", handlers.key, WhisperAction))
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{problems}
+	}
+	return nil
+}
+
 type ChannelBuilder struct {
-	controller *ChannelController
+	name     string
+	builder  *ServerBuilder
+	handlers *channelHandlers
 }
 
-func (b *ServerBuilder) Channel(name string) *ChannelBuilder {
-	controller := ChannelController{
-		connection:     nil,
-		Channel:        nil,
+func newChannelHandlers(key string) *channelHandlers {
+	return &channelHandlers{
+		key:            key,
 		subscribed:     func(Connection, Channel) error { return nil },
 		unsubscribed:   func(Connection, Channel) error { return nil },
 		actionHandlers: make(map[string]ActionHandler),
 	}
-	b.connectionController.channels[name] = &controller
-	return &ChannelBuilder{&controller}
+}
+
+// Channel registers handlers for the named channel. Registering a name twice
+// is reported by Build and Start; the handlers go to the first registration.
+func (b *ServerBuilder) Channel(name string) *ChannelBuilder {
+	channel := &ChannelBuilder{name, b, newChannelHandlers(name)}
+	b.register(func() {
+		switch existing, exists := b.handlers.channels[name]; {
+		case name == "":
+			b.problems = append(b.problems, errors.New("empty channel name"))
+		case exists:
+			b.problems = append(b.problems, fmt.Errorf("channel %q registered twice", name))
+			channel.handlers = existing
+		default:
+			b.handlers.channels[name] = channel.handlers
+		}
+	})
+	return channel
+}
+
+// Channels registers handlers for all channels whose names match the
+// pattern, where `*` stands for any sequence of characters, e.g.
+// `Admin::*Channel`. Channels registered by name take precedence.
+func (b *ServerBuilder) Channels(pattern string) *ChannelBuilder {
+	channel := &ChannelBuilder{pattern, b, newChannelHandlers(pattern)}
+	b.register(func() {
+		if existing := b.route(pattern); existing != nil {
+			b.problems = append(b.problems, fmt.Errorf("channel pattern %q registered twice", pattern))
+			channel.handlers = existing
+			return
+		}
+		b.handlers.routes = append(b.handlers.routes, channelRoute{globMatcher(pattern), channel.handlers})
+	})
+	return channel
+}
+
+// ChannelsMatching is like Channels but matches names with a regular
+// expression.
+func (b *ServerBuilder) ChannelsMatching(re *regexp.Regexp) *ChannelBuilder {
+	key := "/" + re.String() + "/"
+	channel := &ChannelBuilder{key, b, newChannelHandlers(key)}
+	b.register(func() {
+		if existing := b.route(key); existing != nil {
+			b.problems = append(b.problems, fmt.Errorf("channel pattern %s registered twice", key))
+			channel.handlers = existing
+			return
+		}
+		b.handlers.routes = append(b.handlers.routes, channelRoute{re.MatchString, channel.handlers})
+	})
+	return channel
+}
+
+// FallbackChannel registers handlers for channels no other registration
+// matches. Without it, subscriptions to unknown channels are rejected.
+func (b *ServerBuilder) FallbackChannel() *ChannelBuilder {
+	channel := &ChannelBuilder{fallbackKey, b, newChannelHandlers(fallbackKey)}
+	b.register(func() {
+		if b.handlers.fallback != nil {
+			b.problems = append(b.problems, errors.New("fallback channel registered twice"))
+			channel.handlers = b.handlers.fallback
+			return
+		}
+		b.handlers.fallback = channel.handlers
+	})
+	return channel
+}
+
+// route returns the handlers registered for the pattern, if any.
+func (b *ServerBuilder) route(key string) *channelHandlers {
+	for _, route := range b.handlers.routes {
+		if route.handlers.key == key {
+			return route.handlers
+		}
+	}
+	return nil
 }
 
 func (b *ChannelBuilder) Subscribed(subscribed SubscribedHandler) *ChannelBuilder {
-	b.controller.subscribed = subscribed
+	b.builder.register(func() { b.handlers.subscribed = subscribed })
 	return b
 }
 
 func (b *ChannelBuilder) Unsubscribed(unsubscribed UnsubscribedHandler) *ChannelBuilder {
-	b.controller.unsubscribed = unsubscribed
+	b.builder.register(func() { b.handlers.unsubscribed = unsubscribed })
 	return b
 }
 
 func (b *ChannelBuilder) Received(action string, handler ActionHandler) *ChannelBuilder {
-	b.controller.actionHandlers[action] = handler
+	b.builder.register(func() {
+		switch {
+		case action == "":
+			b.builder.problems = append(b.builder.problems, fmt.Errorf("empty action name in channel %q", b.name))
+		case reservedActions[action]:
+			b.builder.problems = append(b.builder.problems, fmt.Errorf("action %q of channel %q is a reserved command", action, b.name))
+		default:
+			b.handlers.actionHandlers[action] = handler
+		}
+	})
+	return b
+}
+
+// Params declares the identifier params subscriptions must carry as a
+// struct, decoded like JSON. Fields tagged `params:"required"` must be present
+// and structs implementing ParamsValidator are validated. Subscriptions with
+// invalid params are rejected; handlers get a pointer to the struct from
+// Channel.Params, e.g. `ch.Params().(*RoomParams)`.
+func (b *ChannelBuilder) Params(prototype interface{}) *ChannelBuilder {
+	b.builder.register(func() {
+		schema, err := newParamsSchema(prototype)
+		if err != nil {
+			b.builder.problems = append(b.builder.problems, fmt.Errorf("channel %q: %v", b.name, err))
+			return
+		}
+		b.handlers.params = schema
+	})
+	return b
+}
+
+// RateLimit limits how often a connection may perform the action.
+func (b *ChannelBuilder) RateLimit(action string, limit RateLimit) *ChannelBuilder {
+	b.builder.register(func() { b.builder.actionRateLimits[actionKey(b.name, action)] = newRateLimit(limit) })
+	return b
+}
+
+// AllowWhisper lets subscribers relay ephemeral messages (e.g. typing
+// indicators) to everyone streaming from stream, using default limits.
+func (b *ChannelBuilder) AllowWhisper(stream string) *ChannelBuilder {
+	return b.AllowWhisperWith(WhisperPolicy{Stream: stream})
+}
+
+// AllowWhisperWith is like AllowWhisper but with custom size and rate limits.
+func (b *ChannelBuilder) AllowWhisperWith(policy WhisperPolicy) *ChannelBuilder {
+	b.builder.register(func() { b.builder.whispers[b.name] = newWhisperPolicy(policy) })
 	return b
 }
@@ -0,0 +1,199 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests below are meant to be run with -race.
+
+func buildStressServer() *activego.ServerBuilder {
+	server := activego.BuildServer(activego.NewBroadcaster(&lockedAdapter{}))
+	server.Connected(func(c activego.Connection) error {
+		return c.IdentifiedBy("user", c.QueryParam("user"))
+	})
+	for _, name := range []string{"ChatChannel", "RoomChannel"} {
+		server.Channel(name).
+			Subscribed(func(c activego.Connection, ch activego.Channel) error {
+				ch.State().Set("room", ch.Param("room"))
+				return ch.StreamFrom(fmt.Sprintf("%v:%v", ch.Name(), ch.Param("room")))
+			}).
+			Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+				return ch.Broadcast(fmt.Sprintf("%v:%v", ch.Name(), ch.Param("room")), data["text"])
+			})
+	}
+	return server
+}
+
+type lockedAdapter struct {
+	mu       sync.Mutex
+	payloads int
+}
+
+func (a *lockedAdapter) BroadcastRaw(payload interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.payloads++
+	return nil
+}
+
+func TestServerBuilder_ConcurrentCalls(t *testing.T) {
+	server := buildStressServer()
+
+	const clients = 50
+	errs := make(chan error, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- runClient(server, i)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+// runClient connects, subscribes to a channel, speaks and checks the replies
+// belong to its own channel and room.
+func runClient(server *activego.ServerBuilder, i int) error {
+	user := fmt.Sprintf("user%d", i)
+	channel := []string{"ChatChannel", "RoomChannel"}[i%2]
+	identifier := fmt.Sprintf(`{"channel":%q,"room":%d}`, channel, i)
+	connect, err := server.Connect(context.Background(), &anycable.ConnectionRequest{
+		Env: &anycable.Env{Url: "http://localhost/cable?user=" + user},
+	})
+	if err != nil {
+		return err
+	}
+	if connect.Identifiers != fmt.Sprintf(`{"user":%q}`, user) {
+		return fmt.Errorf("unexpected identifiers %s", connect.Identifiers)
+	}
+	for j := 0; j < 20; j++ {
+		subscribe, err := server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "subscribe",
+			Identifier:            identifier,
+			ConnectionIdentifiers: connect.Identifiers,
+			Env:                   &anycable.Env{},
+		})
+		if err != nil {
+			return err
+		}
+		if stream := fmt.Sprintf("%s:%d", channel, i); len(subscribe.Streams) != 1 || subscribe.Streams[0] != stream {
+			return fmt.Errorf("expected stream %s, got %v", stream, subscribe.Streams)
+		}
+		if room := subscribe.Env.Istate["room"]; room != fmt.Sprint(i) {
+			return fmt.Errorf("expected room %d in state, got %s", i, room)
+		}
+		action, err := server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "message",
+			Identifier:            identifier,
+			ConnectionIdentifiers: connect.Identifiers,
+			Data:                  `{"action":"speak","text":"hi"}`,
+			Env:                   &anycable.Env{},
+		})
+		if err != nil {
+			return err
+		}
+		if action.Status != anycable.Status_SUCCESS {
+			return fmt.Errorf("action failed: %s", action.ErrorMsg)
+		}
+	}
+	return nil
+}
+
+func TestServerBuilder_FrozenAfterStart(t *testing.T) {
+	server := buildStressServer()
+	_, err := server.Connect(context.Background(), &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(t, err)
+
+	require.Panics(t, func() {
+		server.Channel("LateChannel")
+	})
+}
+
+func TestServerBuilder_Build_Validates(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.NewServerBuilder()
+	server.Channel("ChatChannel").
+		Received("subscribe", func(activego.Connection, activego.Channel, activego.ActionData) error { return nil }).
+		AllowWhisper("chat").
+		Received(activego.WhisperAction, func(activego.Connection, activego.Channel, activego.ActionData) error { return nil })
+	server.Channel("ChatChannel")
+	server.Channel("")
+
+	_, err := server.Build()
+	var configErr *activego.ConfigError
+	require.True(errors.As(err, &configErr))
+	require.Len(configErr.Problems, 5)
+	require.Contains(err.Error(), "reserved command")
+	require.Contains(err.Error(), "registered twice")
+	require.Contains(err.Error(), "empty channel name")
+	require.Contains(err.Error(), "missing broadcaster")
+	require.Contains(err.Error(), "allows whispering")
+}
+
+func TestServerBuilder_Build_Freezes(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.NewServerBuilder().UseBroadcaster(activego.NewBroadcaster(&recordingAdapter{}))
+	server.Channel("ChatChannel")
+	built, err := server.Build()
+	require.NoError(err)
+	require.NotNil(built.Broadcaster)
+	require.Panics(func() {
+		server.Channel("RoomChannel")
+	})
+	require.Panics(func() {
+		built.SetBroadcaster(activego.NewBroadcaster(&recordingAdapter{}))
+	})
+}
+
+func TestServerBuilder_Channel_Duplicate(t *testing.T) {
+	require := require.New(t)
+
+	var spoke bool
+	server := activego.NewServerBuilder().UseBroadcaster(activego.NewBroadcaster(&recordingAdapter{}))
+	server.Channel("ChatChannel")
+	server.Channel("ChatChannel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error {
+			spoke = true
+			return nil
+		})
+	_, err := server.Build()
+	require.Error(err)
+
+	r, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.True(spoke)
+}
+
+func TestServerBuilder_MakeEmbedded_InvalidConfiguration(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.NewServerBuilder()
+	server.Channel("ChatChannel")
+	server.Channel("ChatChannel")
+	_, err := server.Start()
+	require.Error(err)
+
+	// MakeEmbedded only logs the problem and starts anyway.
+	embedded := server.MakeEmbedded()
+	defer embedded.Shutdown()
+	require.NotNil(server.Broadcaster)
+	r, err := subscribeTo(server, "ChatChannel")
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+}
@@ -0,0 +1,157 @@
+package activego
+
+import "errors"
+
+// ErrHalt is returned by a before callback to skip the rest of the chain
+// and the handler without failing the command. Any other error halts the
+// chain too, and the command fails with it.
+var ErrHalt = errors.New("callback chain halted")
+
+type ConnectionCallback func(Connection) error
+type ChannelCallback func(Connection, Channel) error
+type PerformCallback func(c Connection, ch Channel, action string, data ActionData) error
+
+// channelCallbacks are the callback chains of a channel or, registered with
+// a ServerBuilder, of all channels. Callbacks run in the order they were
+// registered, those of the server first.
+type channelCallbacks struct {
+	beforeSubscribe   []ChannelCallback
+	afterSubscribe    []ChannelCallback
+	beforeUnsubscribe []ChannelCallback
+	afterUnsubscribe  []ChannelCallback
+	beforePerform     []PerformCallback
+	afterPerform      []PerformCallback
+}
+
+// runCallbacks runs the server's and the channel's callbacks, stopping at
+// the first error.
+func runCallbacks(server, channel []ChannelCallback, c Connection, ch Channel) error {
+	for _, chain := range [][]ChannelCallback{server, channel} {
+		for _, callback := range chain {
+			if err := callback(c, ch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runPerformCallbacks(server, channel []PerformCallback, c Connection, ch Channel, action string, data ActionData) error {
+	for _, chain := range [][]PerformCallback{server, channel} {
+		for _, callback := range chain {
+			if err := callback(c, ch, action, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runConnectionCallbacks(chain []ConnectionCallback, c Connection) error {
+	for _, callback := range chain {
+		if err := callback(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// halted turns ErrHalt returned by callbacks into success.
+func halted(err error) error {
+	if errors.Is(err, ErrHalt) {
+		return nil
+	}
+	return err
+}
+
+// BeforeConnect adds a callback run before the Connected handler. The
+// connection is rejected if it returns an error other than ErrHalt. ErrHalt
+// skips the following callbacks and the Connected handler but still accepts
+// and welcomes the connection; return another error to reject it.
+func (b *ServerBuilder) BeforeConnect(f ConnectionCallback) *ServerBuilder {
+	b.register(func() { b.handlers.beforeConnect = append(b.handlers.beforeConnect, f) })
+	return b
+}
+
+// AfterDisconnect adds a callback run after the Disconnected handler.
+func (b *ServerBuilder) AfterDisconnect(f ConnectionCallback) *ServerBuilder {
+	b.register(func() { b.handlers.afterDisconnect = append(b.handlers.afterDisconnect, f) })
+	return b
+}
+
+// BeforeSubscribe adds a callback run before the Subscribed handler of every
+// channel.
+func (b *ServerBuilder) BeforeSubscribe(f ChannelCallback) *ServerBuilder {
+	b.register(func() { b.handlers.beforeSubscribe = append(b.handlers.beforeSubscribe, f) })
+	return b
+}
+
+// AfterSubscribe adds a callback run after the Subscribed handler of every
+// channel succeeds.
+func (b *ServerBuilder) AfterSubscribe(f ChannelCallback) *ServerBuilder {
+	b.register(func() { b.handlers.afterSubscribe = append(b.handlers.afterSubscribe, f) })
+	return b
+}
+
+// BeforeUnsubscribe adds a callback run before the Unsubscribed handler of
+// every channel.
+func (b *ServerBuilder) BeforeUnsubscribe(f ChannelCallback) *ServerBuilder {
+	b.register(func() { b.handlers.beforeUnsubscribe = append(b.handlers.beforeUnsubscribe, f) })
+	return b
+}
+
+// AfterUnsubscribe adds a callback run after the Unsubscribed handler of
+// every channel succeeds.
+func (b *ServerBuilder) AfterUnsubscribe(f ChannelCallback) *ServerBuilder {
+	b.register(func() { b.handlers.afterUnsubscribe = append(b.handlers.afterUnsubscribe, f) })
+	return b
+}
+
+// BeforePerform adds a callback run before actions of every channel.
+func (b *ServerBuilder) BeforePerform(f PerformCallback) *ServerBuilder {
+	b.register(func() { b.handlers.beforePerform = append(b.handlers.beforePerform, f) })
+	return b
+}
+
+// AfterPerform adds a callback run after actions of every channel succeed.
+func (b *ServerBuilder) AfterPerform(f PerformCallback) *ServerBuilder {
+	b.register(func() { b.handlers.afterPerform = append(b.handlers.afterPerform, f) })
+	return b
+}
+
+// BeforeSubscribe adds a callback run before the Subscribed handler.
+func (b *ChannelBuilder) BeforeSubscribe(f ChannelCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.beforeSubscribe = append(b.handlers.beforeSubscribe, f) })
+	return b
+}
+
+// AfterSubscribe adds a callback run after the Subscribed handler succeeds.
+func (b *ChannelBuilder) AfterSubscribe(f ChannelCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.afterSubscribe = append(b.handlers.afterSubscribe, f) })
+	return b
+}
+
+// BeforeUnsubscribe adds a callback run before the Unsubscribed handler.
+func (b *ChannelBuilder) BeforeUnsubscribe(f ChannelCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.beforeUnsubscribe = append(b.handlers.beforeUnsubscribe, f) })
+	return b
+}
+
+// AfterUnsubscribe adds a callback run after the Unsubscribed handler
+// succeeds.
+func (b *ChannelBuilder) AfterUnsubscribe(f ChannelCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.afterUnsubscribe = append(b.handlers.afterUnsubscribe, f) })
+	return b
+}
+
+// BeforePerform adds a callback run before the channel's actions.
+func (b *ChannelBuilder) BeforePerform(f PerformCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.beforePerform = append(b.handlers.beforePerform, f) })
+	return b
+}
+
+// AfterPerform adds a callback run after the channel's actions succeed.
+func (b *ChannelBuilder) AfterPerform(f PerformCallback) *ChannelBuilder {
+	b.builder.register(func() { b.handlers.afterPerform = append(b.handlers.afterPerform, f) })
+	return b
+}
@@ -0,0 +1,143 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbacks_Order(t *testing.T) {
+	require := require.New(t)
+
+	var calls []string
+	record := func(name string) activego.ChannelCallback {
+		return func(activego.Connection, activego.Channel) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	server := activego.BuildServer(nil)
+	server.BeforeSubscribe(record("server before"))
+	server.AfterSubscribe(record("server after"))
+	server.Channel("ChatChannel").
+		BeforeSubscribe(record("before 1")).
+		BeforeSubscribe(record("before 2")).
+		AfterSubscribe(record("after")).
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			return record("subscribed")(c, ch)
+		})
+
+	r, err := subscribeTo(server, "ChatChannel")
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{"server before", "before 1", "before 2", "subscribed", "server after", "after"}, calls)
+}
+
+func TestCallbacks_Halting(t *testing.T) {
+	require := require.New(t)
+
+	var performed []string
+	server := activego.BuildServer(nil)
+	server.BeforePerform(func(c activego.Connection, ch activego.Channel, action string, data activego.ActionData) error {
+		switch action {
+		case "skip":
+			return activego.ErrHalt
+		case "deny":
+			return errors.New("denied")
+		}
+		return nil
+	})
+	handler := func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+		performed = append(performed, data["action"].(string))
+		return nil
+	}
+	server.Channel("ChatChannel").
+		Received("speak", handler).
+		Received("skip", handler).
+		Received("deny", handler).
+		AfterPerform(func(c activego.Connection, ch activego.Channel, action string, data activego.ActionData) error {
+			performed = append(performed, "after "+action)
+			return nil
+		})
+
+	perform := func(action string) anycable.Status {
+		r, err := server.Command(context.Background(), performMessage(action))
+		require.NoError(err)
+		return r.Status
+	}
+	require.Equal(anycable.Status_SUCCESS, perform("speak"))
+	require.Equal(anycable.Status_SUCCESS, perform("skip"))
+	require.Equal(anycable.Status_FAILURE, perform("deny"))
+	require.Equal([]string{"speak", "after speak"}, performed)
+}
+
+func TestCallbacks_BeforeConnect(t *testing.T) {
+	require := require.New(t)
+
+	var connected, disconnected bool
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{}))
+	server.BeforeConnect(func(c activego.Connection) error {
+		if c.QueryParam("token") == "" {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	server.Connected(func(activego.Connection) error {
+		connected = true
+		return nil
+	})
+	server.AfterDisconnect(func(activego.Connection) error {
+		disconnected = true
+		return nil
+	})
+
+	r, err := server.Connect(context.Background(), &anycable.ConnectionRequest{
+		Env: &anycable.Env{Url: "ws://example.com/cable"},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"type":"disconnect","reason":"unauthorized","reconnect":false}`}, r.Transmissions)
+	require.False(connected)
+
+	r, err = server.Connect(context.Background(), &anycable.ConnectionRequest{
+		Env: &anycable.Env{Url: "ws://example.com/cable?token=secret"},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.True(connected)
+
+	_, err = server.Disconnect(context.Background(), &anycable.DisconnectRequest{Identifiers: `{}`, Env: &anycable.Env{}})
+	require.NoError(err)
+	require.True(disconnected)
+}
+
+func TestCallbacks_BeforeConnect_Halt(t *testing.T) {
+	require := require.New(t)
+
+	var later, connected bool
+	server := activego.BuildServer(nil)
+	server.BeforeConnect(func(activego.Connection) error { return activego.ErrHalt })
+	server.BeforeConnect(func(activego.Connection) error {
+		later = true
+		return nil
+	})
+	server.Connected(func(activego.Connection) error {
+		connected = true
+		return nil
+	})
+
+	// Halting skips the rest of the chain and the handler, but the
+	// connection is accepted.
+	r, err := server.Connect(context.Background(), &anycable.ConnectionRequest{
+		Env: &anycable.Env{Url: "ws://example.com/cable"},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{`{"type":"welcome"}`}, r.Transmissions)
+	require.False(later)
+	require.False(connected)
+}
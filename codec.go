@@ -0,0 +1,82 @@
+package activego
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec serializes transmissions, broadcasts or channel/connection state.
+// Encoded data travels in protobuf string fields, so it must be valid UTF-8.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONEncoder is implemented by codecs whose output is JSON, the only format
+// nodes pass on to clients (actioncable-v1-json). Only those reporting it
+// can encode transmissions and broadcasts, see ServerBuilder.UseCodec.
+type JSONEncoder interface {
+	EncodesJSON() bool
+}
+
+// DefaultCodec is used unless a server is configured with another one.
+var DefaultCodec Codec = JSONCodec{}
+
+// JSONCodec encodes messages as JSON, the only format anycable nodes send
+// clients (actioncable-v1-json).
+type JSONCodec struct {
+	// UseNumber decodes numbers as json.Number instead of float64 so large
+	// integers don't lose precision.
+	UseNumber bool
+}
+
+func (c JSONCodec) EncodesJSON() bool {
+	return true
+}
+
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if c.UseNumber {
+		decoder.UseNumber()
+	}
+	return decoder.Decode(v)
+}
+
+// MsgpackCodec encodes state values as base64-encoded MessagePack, which
+// is more compact than JSON for binary data and keeps integer types (see
+// ServerBuilder.UseStateCodec). Nodes speak JSON to clients, so it can't
+// encode transmissions or broadcasts.
+//
+// Integers decode to Go integer types rather than float64, so use
+// State.Get instead of UpdateFloat64 for numeric state.
+type MsgpackCodec struct{}
+
+func (c MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
+	base64.StdEncoding.Encode(encoded, buf.Bytes())
+	return encoded, nil
+}
+
+func (c MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(decoded, data)
+	if err != nil {
+		return err
+	}
+	decoder := msgpack.NewDecoder(bytes.NewReader(decoded[:n]))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
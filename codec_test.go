@@ -0,0 +1,102 @@
+package activego_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec_JSON_UseNumber(t *testing.T) {
+	require := require.New(t)
+
+	state, err := activego.DecodeSimpleStateWith(activego.JSONCodec{UseNumber: true}, map[string]string{"id": "9007199254740993"})
+	require.NoError(err)
+	require.Equal(json.Number("9007199254740993"), state.Get("id"))
+}
+
+func TestCodec_Msgpack_UsesJSONTags(t *testing.T) {
+	require := require.New(t)
+
+	codec := activego.MsgpackCodec{}
+	bs, err := codec.Marshal(activego.CommandResponseTransmission{Type: "confirm_subscription", Identifier: "x"})
+	require.NoError(err)
+	var decoded map[string]interface{}
+	require.NoError(codec.Unmarshal(bs, &decoded))
+	require.Equal(map[string]interface{}{"type": "confirm_subscription", "identifier": "x"}, decoded)
+}
+
+func TestCodec_Msgpack_State(t *testing.T) {
+	require := require.New(t)
+
+	codec := activego.MsgpackCodec{}
+	state, err := activego.DecodeSimpleStateWith(codec, nil)
+	require.NoError(err)
+	state.Set("name", "john")
+	changes, err := state.Changes()
+	require.NoError(err)
+	decoded, err := activego.DecodeSimpleStateWith(codec, changes)
+	require.NoError(err)
+	require.Equal("john", decoded.Get("name"))
+}
+
+func TestCodec_Msgpack_ValidUTF8(t *testing.T) {
+	require := require.New(t)
+
+	bs, err := activego.MsgpackCodec{}.Marshal([]byte{0xff, 0xfe})
+	require.NoError(err)
+	require.True(utf8.Valid(bs))
+}
+
+func TestCodec_Msgpack_StateOnly(t *testing.T) {
+	require := require.New(t)
+
+	_, err := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{})).
+		UseCodec(activego.MsgpackCodec{}).
+		Build()
+	require.Error(err)
+
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{})).
+		UseStateCodec(activego.MsgpackCodec{})
+	server.Channel("ChatChannel").Subscribed(func(c activego.Connection, ch activego.Channel) error {
+		ch.State().Set("room", "lobby")
+		return nil
+	})
+	s, err := server.Build()
+	require.NoError(err)
+	r, err := s.Command(context.Background(), &anycable.CommandMessage{
+		Command:               "subscribe",
+		Identifier:            `{"channel":"ChatChannel"}`,
+		ConnectionIdentifiers: `{}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal([]string{`{"type":"confirm_subscription","identifier":"{\"channel\":\"ChatChannel\"}"}`}, r.Transmissions)
+	var room string
+	require.NoError(activego.MsgpackCodec{}.Unmarshal([]byte(r.Env.Istate["room"]), &room))
+	require.Equal("lobby", room)
+}
+
+// textCodec encodes JSON without reporting it.
+type textCodec struct{}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (textCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func TestCodec_UseCodec_RequiresJSONEncoder(t *testing.T) {
+	require := require.New(t)
+
+	_, err := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{})).
+		UseCodec(textCodec{}).
+		Build()
+	require.Error(err)
+
+	_, err = activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{})).
+		UseCodec(struct{ activego.JSONCodec }{}).
+		Build()
+	require.NoError(err)
+}
@@ -0,0 +1,235 @@
+package activego_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func startEmbedded(t *testing.T) (anycable.EmbeddedAnycable, func()) {
+	server := activego.BuildServer(nil)
+	server.AcceptProtobuf()
+	server.Channel("ChatChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			return ch.StreamFrom("chat")
+		}).
+		Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			return ch.Broadcast("chat", data["text"])
+		}).
+		AllowWhisperWith(activego.WhisperPolicy{Stream: "chat", MaxSize: 64})
+	embedded, err := server.Start()
+	require.NoError(t, err)
+	return embedded, embedded.Shutdown
+}
+
+func startWebsocket(t *testing.T) (*httptest.Server, func()) {
+	embedded, stop := startEmbedded(t)
+	ts := httptest.NewServer(embedded)
+	return ts, func() {
+		ts.Close()
+		stop()
+	}
+}
+
+func dial(t *testing.T, ts *httptest.Server, subprotocol string) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	ws, _, err := dialer.Dial(strings.Replace(ts.URL, "http", "ws", 1), nil)
+	require.NoError(t, err)
+	require.Equal(t, subprotocol, ws.Subprotocol())
+	return ws
+}
+
+func TestEmbedded_Protobuf(t *testing.T) {
+	require := require.New(t)
+
+	ts, stop := startWebsocket(t)
+	defer stop()
+	ws := dial(t, ts, anycable.ProtobufSubprotocol)
+	defer ws.Close()
+
+	readMessage := func() *anycable.ProtobufMessage {
+		for {
+			mt, data, err := ws.ReadMessage()
+			require.NoError(err)
+			require.Equal(websocket.BinaryMessage, mt)
+			msg := &anycable.ProtobufMessage{}
+			require.NoError(proto.Unmarshal(data, msg))
+			if msg.Type != anycable.ProtobufType_ping {
+				return msg
+			}
+		}
+	}
+
+	require.Equal(anycable.ProtobufType_welcome, readMessage().Type)
+
+	subscribe, err := proto.Marshal(&anycable.ProtobufMessage{
+		Command:    anycable.ProtobufCommand_subscribe,
+		Identifier: `{"channel":"ChatChannel"}`,
+	})
+	require.NoError(err)
+	require.NoError(ws.WriteMessage(websocket.BinaryMessage, subscribe))
+
+	msg := readMessage()
+	require.Equal(anycable.ProtobufType_confirm_subscription, msg.Type)
+	require.Equal(`{"channel":"ChatChannel"}`, msg.Identifier)
+}
+
+func TestEmbedded_Protobuf_InvalidFrame(t *testing.T) {
+	require := require.New(t)
+
+	ts, stop := startWebsocket(t)
+	defer stop()
+	ws := dial(t, ts, anycable.ProtobufSubprotocol)
+	defer ws.Close()
+
+	require.NoError(ws.WriteMessage(websocket.BinaryMessage, []byte{0xff}))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err != nil {
+			require.True(websocket.IsCloseError(err, websocket.CloseUnsupportedData), err)
+			return
+		}
+	}
+}
+
+func TestEmbedded_JSONAlongsideProtobuf(t *testing.T) {
+	require := require.New(t)
+
+	ts, stop := startWebsocket(t)
+	defer stop()
+	ws := dial(t, ts, "actioncable-v1-json")
+	defer ws.Close()
+
+	var welcome map[string]interface{}
+	require.NoError(ws.ReadJSON(&welcome))
+	require.Equal("welcome", welcome["type"])
+}
+
+func TestEmbedded_Headers(t *testing.T) {
+	require := require.New(t)
+
+	type request struct {
+		origin, cookie, forwardedFor string
+	}
+	requests := make(chan request, 1)
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		r := request{origin: c.Origin(), forwardedFor: c.ForwardedHeaders().Get("X-Forwarded-For")}
+		if cookie, err := c.Cookie("session"); err == nil {
+			r.cookie = cookie.Value
+		}
+		requests <- r
+		return nil
+	})
+	embedded, err := server.Start()
+	require.NoError(err)
+	defer embedded.Shutdown()
+	ts := httptest.NewServer(embedded)
+	defer ts.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial(strings.Replace(ts.URL, "http", "ws", 1), http.Header{
+		"Origin":          {"http://example.com"},
+		"Cookie":          {"session=xyz; theme=dark"},
+		"X-Forwarded-For": {"1.2.3.4"},
+	})
+	require.NoError(err)
+	defer ws.Close()
+	require.Equal(request{"http://example.com", "xyz", "1.2.3.4"}, <-requests)
+}
+
+func TestEmbedded_Whisper(t *testing.T) {
+	require := require.New(t)
+
+	ts, stop := startWebsocket(t)
+	defer stop()
+
+	identifier := `{"channel":"ChatChannel"}`
+	readJSON := func(ws *websocket.Conn) map[string]interface{} {
+		for {
+			var msg map[string]interface{}
+			require.NoError(ws.ReadJSON(&msg))
+			if msg["type"] != "ping" {
+				return msg
+			}
+		}
+	}
+	perform := func(ws *websocket.Conn, data string) {
+		require.NoError(ws.WriteJSON(map[string]string{"command": "message", "identifier": identifier, "data": data}))
+	}
+	subscribed := func() *websocket.Conn {
+		ws := dial(t, ts, "actioncable-v1-json")
+		require.Equal("welcome", readJSON(ws)["type"])
+		require.NoError(ws.WriteJSON(map[string]string{"command": "subscribe", "identifier": identifier}))
+		require.Equal("confirm_subscription", readJSON(ws)["type"])
+		return ws
+	}
+	sender, receiver := subscribed(), subscribed()
+	defer sender.Close()
+	defer receiver.Close()
+
+	perform(sender, `{"action":"whisper","typing":true}`)
+	whisper := readJSON(receiver)["message"].(map[string]interface{})
+	require.Equal("whisper", whisper["type"])
+
+	// Rejected whispers are reported to the sender only.
+	perform(sender, `{"action":"whisper","text":"`+strings.Repeat("a", 64)+`"}`)
+	rejection := readJSON(sender)["message"].(map[string]interface{})
+	require.Equal("too_large", rejection["code"])
+
+	// The sender gets the broadcast following the whisper, not the whisper.
+	perform(sender, `{"action":"speak","text":"hi"}`)
+	require.Equal("hi", readJSON(sender)["message"])
+	require.Equal("hi", readJSON(receiver)["message"])
+}
+
+func TestEmbedded_SSE(t *testing.T) {
+	require := require.New(t)
+
+	embedded, stop := startEmbedded(t)
+	defer stop()
+	ts := httptest.NewServer(embedded.SSEHandler)
+	defer ts.Close()
+
+	identifier := `{"channel":"ChatChannel"}`
+	resp, err := http.Get(ts.URL + "?identifier=" + url.QueryEscape(identifier))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := bufio.NewScanner(resp.Body)
+	nextData := func() string {
+		for events.Scan() {
+			if line := events.Text(); strings.HasPrefix(line, "data: ") {
+				return strings.TrimPrefix(line, "data: ")
+			}
+		}
+		require.NoError(events.Err())
+		return ""
+	}
+
+	var session struct {
+		SID string `json:"sid"`
+	}
+	require.NoError(json.Unmarshal([]byte(nextData()), &session))
+	require.NotEmpty(session.SID)
+	require.Equal(`{"type":"welcome"}`, nextData())
+	require.Equal(`{"type":"confirm_subscription","identifier":"{\"channel\":\"ChatChannel\"}"}`, nextData())
+
+	command := `{"command":"message","identifier":"{\"channel\":\"ChatChannel\"}","data":"{\"action\":\"speak\",\"text\":\"hi\"}"}`
+	post, err := http.Post(ts.URL+"?sid="+session.SID, "application/json", strings.NewReader(command))
+	require.NoError(err)
+	post.Body.Close()
+	require.Equal(http.StatusAccepted, post.StatusCode)
+
+	require.Equal(`{"identifier":"{\"channel\":\"ChatChannel\"}","message":"hi"}`, nextData())
+}
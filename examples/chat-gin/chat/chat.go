@@ -5,7 +5,7 @@ import (
 )
 
 func Connected(c activego.Connection) error {
-	return c.IdentifiedBy("user", c.URL().Query().Get("user"))
+	return c.IdentifiedBy("user", c.QueryParam("user"))
 }
 
 func Subscribed(c activego.Connection, ch activego.Channel) error {
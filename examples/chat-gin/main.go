@@ -45,11 +45,14 @@ func main() {
 		c.HTML(http.StatusOK, "app.tmpl", gin.H{})
 	})
 
-	server := activego.BuildServer(nil) // TODO: Passing nil to BuildServer doesn't make sense as DSL.
+	server := activego.NewServerBuilder()
 	server.Connected(chat.Connected)
 	chatCh := server.Channel("ChatChannel")
 	chatCh.Subscribed(chat.Subscribed).Received("message", chat.Message)
-	embeddedAnycable := server.MakeEmbedded()
+	embeddedAnycable, err := server.Start()
+	if err != nil {
+		log.Fatal(err)
+	}
 	router.GET("/cable", gin.WrapH(embeddedAnycable))
 
 	if !*isDev {
@@ -61,7 +64,7 @@ func main() {
 }
 
 func Connected(c activego.Connection) error {
-	return c.IdentifiedBy("user", c.URL().Query().Get("user"))
+	return c.IdentifiedBy("user", c.QueryParam("user"))
 }
 
 func Subscribed(c activego.Connection, ch activego.Channel) error {
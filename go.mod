@@ -1,20 +1,20 @@
 module github.com/bilus/activego
 
-
 go 1.14
 
 require (
 	github.com/anycable/anycable-go v1.0.2
 	github.com/apex/log v1.9.0
-	github.com/davecgh/go-spew v1.1.1
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.4.3
-	github.com/iancoleman/strcase v0.1.2
-	github.com/matoous/go-nanoid v1.5.0 // indirect
+	github.com/gorilla/websocket v1.4.2
+	github.com/matoous/go-nanoid v1.5.0
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/mitchellh/go-mruby v0.0.0-20200315023956-207cedc21542 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/stretchr/objx v0.3.0 // indirect
 	github.com/stretchr/testify v1.6.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	golang.org/x/net v0.0.0-20201010224723-4f7140c49acb // indirect
 	golang.org/x/sys v0.0.0-20201015000850-e3ed0017c211 // indirect
 	google.golang.org/genproto v0.0.0-20201015140912-32ed001d685c // indirect
@@ -0,0 +1,27 @@
+package history
+
+import (
+	"time"
+)
+
+// Entry is a message broadcast to a stream along with its offset.
+type Entry struct {
+	Offset uint64
+	Data   string
+	Time   time.Time
+}
+
+// History keeps recent broadcasts per stream so that clients reconnecting
+// after a network blip can catch up on messages they missed. Offsets are
+// positive and grow monotonically per stream, not necessarily by one.
+//
+// Implementations must be safe for concurrent use. Durable stores (e.g.
+// Redis streams) can implement it to survive restarts and share history
+// between nodes.
+type History interface {
+	// Append stores data broadcast to the stream and returns its offset.
+	Append(stream string, data string) (uint64, error)
+	// Since returns the retained entries of the stream with offsets greater
+	// than offset, oldest first.
+	Since(stream string, offset uint64) ([]Entry, error)
+}
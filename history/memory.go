@@ -0,0 +1,125 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// seqBits is the size of the sequence number in offsets, see Memory.
+const seqBits = 21
+
+const maxSeq = 1<<seqBits - 1
+
+// Memory is an in-memory History keeping up to size entries per stream in a
+// ring buffer. Entries older than ttl are discarded, along with the streams
+// whose entries have all expired; zero ttl keeps them until they're
+// overwritten.
+//
+// Offsets combine an epoch, in the high bits, with a 21-bit sequence number,
+// staying below 2^53 so that JavaScript clients get them exactly. A stream gets
+// a new epoch, greater than any given before, whenever its ring is created or
+// its sequence runs out, so offsets keep growing after a stream is discarded
+// and, since epochs start from the Unix time in seconds, after the process
+// restarts.
+type Memory struct {
+	size int
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	streams   map[string]*ring
+	lastEpoch uint64
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type ring struct {
+	entries []Entry
+	start   int
+	epoch   uint64
+	seq     uint64
+}
+
+func NewMemory(size int, ttl time.Duration) *Memory {
+	if size < 1 {
+		size = 1
+	}
+	return &Memory{
+		size:    size,
+		ttl:     ttl,
+		streams: make(map[string]*ring),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Append(stream string, data string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	r, ok := m.streams[stream]
+	if !ok {
+		r = &ring{}
+		m.streams[stream] = r
+	}
+	if r.epoch == 0 || r.seq == maxSeq {
+		r.epoch = m.nextEpoch(now)
+		r.seq = 0
+	}
+	r.seq++
+	entry := Entry{Offset: r.epoch<<seqBits | r.seq, Data: data, Time: now}
+	if len(r.entries) < m.size {
+		r.entries = append(r.entries, entry)
+	} else {
+		r.entries[r.start] = entry
+		r.start = (r.start + 1) % m.size
+	}
+	return entry.Offset, nil
+}
+
+func (m *Memory) Since(stream string, offset uint64) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.streams[stream]
+	if !ok {
+		return nil, nil
+	}
+	now := m.now()
+	var result []Entry
+	for i := 0; i < len(r.entries); i++ {
+		entry := r.entries[(r.start+i)%len(r.entries)]
+		if entry.Offset <= offset || m.expired(entry, now) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func (m *Memory) expired(entry Entry, now time.Time) bool {
+	return m.ttl > 0 && now.Sub(entry.Time) > m.ttl
+}
+
+// nextEpoch returns the current Unix time in seconds, or the epoch following
+// the last one if the clock hasn't moved past it.
+func (m *Memory) nextEpoch(now time.Time) uint64 {
+	epoch := uint64(now.Unix())
+	if epoch <= m.lastEpoch {
+		epoch = m.lastEpoch + 1
+	}
+	m.lastEpoch = epoch
+	return epoch
+}
+
+// sweep discards streams whose entries have all expired.
+func (m *Memory) sweep(now time.Time) {
+	if m.ttl == 0 || now.Sub(m.lastSweep) < m.ttl {
+		return
+	}
+	m.lastSweep = now
+	for stream, r := range m.streams {
+		newest := r.entries[(r.start+len(r.entries)-1)%len(r.entries)]
+		if m.expired(newest, now) {
+			delete(m.streams, stream)
+		}
+	}
+}
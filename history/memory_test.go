@@ -0,0 +1,64 @@
+package history_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bilus/activego/history"
+	"github.com/stretchr/testify/require"
+)
+
+func data(entries []history.Entry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.Data)
+	}
+	return result
+}
+
+func TestMemory_Since(t *testing.T) {
+	require := require.New(t)
+
+	h := history.NewMemory(10, 0)
+	var offsets []uint64
+	for _, d := range []string{"a", "b", "c"} {
+		offset, err := h.Append("s", d)
+		require.NoError(err)
+		offsets = append(offsets, offset)
+	}
+	require.True(offsets[0] < offsets[1] && offsets[1] < offsets[2])
+	entries, err := h.Since("s", offsets[0])
+	require.NoError(err)
+	require.Equal([]string{"b", "c"}, data(entries))
+	require.Equal(offsets[2], entries[1].Offset)
+}
+
+func TestMemory_RingOverwritesOldest(t *testing.T) {
+	require := require.New(t)
+
+	h := history.NewMemory(2, 0)
+	for _, d := range []string{"a", "b", "c", "d"} {
+		_, err := h.Append("s", d)
+		require.NoError(err)
+	}
+	entries, err := h.Since("s", 0)
+	require.NoError(err)
+	require.Equal([]string{"c", "d"}, data(entries))
+}
+
+func TestMemory_TTL(t *testing.T) {
+	require := require.New(t)
+
+	h := history.NewMemory(10, 10*time.Millisecond)
+	expired, err := h.Append("s", "a")
+	require.NoError(err)
+	time.Sleep(20 * time.Millisecond)
+	offset, err := h.Append("s", "b")
+	require.NoError(err)
+	// The expired stream was discarded: its offsets start over in a new epoch.
+	require.Greater(offset, expired)
+	require.Equal(uint64(1), offset&(1<<21-1))
+	entries, err := h.Since("s", 0)
+	require.NoError(err)
+	require.Equal([]string{"b"}, data(entries))
+}
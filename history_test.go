@@ -0,0 +1,106 @@
+package activego_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/bilus/activego/history"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_Broadcast(t *testing.T) {
+	require := require.New(t)
+
+	h := history.NewMemory(10, 0)
+	adapter := &recordingAdapter{}
+	server := activego.BuildServer(activego.NewBroadcaster(adapter))
+	server.StreamHistory(h)
+	server.Channel("ChatChannel").AllowWhisperWith(activego.WhisperPolicy{Stream: "chat", MaxSize: 64})
+
+	require.NoError(server.Broadcaster.Broadcast("chat", "one"))
+	entries, err := h.Since("chat", 0)
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal([]interface{}{
+		&anycable.Broadcast{Stream: "chat", Data: `"one"`, Offset: entries[0].Offset},
+	}, adapter.payloads)
+
+	// Neither whispers nor disconnect commands are replayed.
+	c := anycable.NewIncomingContext(context.Background(), "sid1", "v1")
+	r, err := server.Command(c, &anycable.CommandMessage{
+		Command:               "message",
+		Identifier:            `{"channel":"ChatChannel"}`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Data:                  `{"action":"whisper","typing":true}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	_, err = server.Disconnect(c, &anycable.DisconnectRequest{
+		Identifiers: `{"user":"john"}`,
+		Env:         &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Len(adapter.payloads, 3)
+	entries, err = h.Since("chat", 0)
+	require.NoError(err)
+	require.Len(entries, 1)
+	entries, err = h.Since(`{"user":"john"}`, 0)
+	require.NoError(err)
+	require.Empty(entries)
+}
+
+func TestHistory_Resume(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.StreamHistory(history.NewMemory(10, 0))
+	server.Channel("ChatChannel").Subscribed(streamingFrom("chat"))
+	embedded, err := server.Start()
+	require.NoError(err)
+	defer embedded.Shutdown()
+	ts := httptest.NewServer(embedded)
+	defer ts.Close()
+
+	identifier := `{"channel":"ChatChannel"}`
+	readJSON := func(ws *websocket.Conn) map[string]interface{} {
+		for {
+			var msg map[string]interface{}
+			require.NoError(ws.ReadJSON(&msg))
+			if msg["type"] != "ping" {
+				return msg
+			}
+		}
+	}
+	subscribe := func(data string) *websocket.Conn {
+		ws := dial(t, ts, anycable.JSONSubprotocol)
+		require.Equal("welcome", readJSON(ws)["type"])
+		require.NoError(ws.WriteJSON(map[string]string{"command": "subscribe", "identifier": identifier, "data": data}))
+		require.Equal("confirm_subscription", readJSON(ws)["type"])
+		return ws
+	}
+
+	live := subscribe("")
+	defer live.Close()
+	require.NoError(server.Broadcaster.Broadcast("secret", "hidden"))
+	require.NoError(server.Broadcaster.Broadcast("chat", "one"))
+	require.NoError(server.Broadcaster.Broadcast("chat", "two"))
+	one, two := readJSON(live), readJSON(live)
+	require.Equal("one", one["message"])
+	require.Equal("chat", one["stream"])
+	require.Equal("two", two["message"])
+	require.Greater(two["offset"], one["offset"])
+
+	// Only the messages missed on the streams of the subscription are
+	// replayed, before live ones.
+	resumed := subscribe(fmt.Sprintf(`{"offsets":{"chat":%.0f,"secret":0}}`, one["offset"]))
+	defer resumed.Close()
+	require.Equal(two, readJSON(resumed))
+	require.NoError(server.Broadcaster.Broadcast("chat", "three"))
+	require.Equal("three", readJSON(resumed)["message"])
+}
@@ -0,0 +1,69 @@
+package activego
+
+import "sort"
+
+// ChannelInfo describes a channel registration, e.g. to generate client
+// stubs or documentation.
+type ChannelInfo struct {
+	// Name is the channel name, the pattern the registration matches names
+	// with (see Channels and ChannelsMatching) or, for the fallback channel,
+	// empty.
+	Name     string `json:"name"`
+	Pattern  bool   `json:"pattern,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+	// Actions are the actions with a handler, sorted by name.
+	Actions []string `json:"actions"`
+	// AnyAction is set if actions without a handler are handled too.
+	AnyAction bool        `json:"any_action,omitempty"`
+	Params    []ParamInfo `json:"params,omitempty"`
+	Whisper   bool        `json:"whisper,omitempty"`
+}
+
+// ParamInfo describes an identifier param declared with
+// ChannelBuilder.Params.
+type ParamInfo struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Registered lists the channel registrations: channels sorted by name, then
+// patterns in the order they're tried and the fallback channel. It only
+// reflects registrations made so far, so call it once the server is
+// configured, e.g. after Build.
+func (b *ServerBuilder) Registered() []ChannelInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	registered := b.handlers.registered()
+	infos := make([]ChannelInfo, len(registered))
+	for i, handlers := range registered {
+		info := ChannelInfo{
+			Name:      handlers.key,
+			Pattern:   b.handlers.channels[handlers.key] != handlers && handlers != b.handlers.fallback,
+			Fallback:  handlers == b.handlers.fallback,
+			Actions:   make([]string, 0, len(handlers.actionHandlers)),
+			AnyAction: handlers.perform != nil,
+		}
+		for action := range handlers.actionHandlers {
+			info.Actions = append(info.Actions, action)
+		}
+		sort.Strings(info.Actions)
+		if handlers.params != nil {
+			info.Params = handlers.params.info()
+		}
+		_, info.Whisper = b.whispers[handlers.key]
+		infos[i] = info
+	}
+	return infos
+}
+
+func (schema *paramsSchema) info() []ParamInfo {
+	required := make(map[string]bool, len(schema.required))
+	for _, name := range schema.required {
+		required[name] = true
+	}
+	params := make([]ParamInfo, len(schema.fields))
+	for i, name := range schema.fields {
+		params[i] = ParamInfo{Name: name, Required: required[name]}
+	}
+	return params
+}
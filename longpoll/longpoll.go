@@ -0,0 +1,234 @@
+// Package longpoll serves ActionCable channels over HTTP long polling for
+// networks where neither WebSockets nor Server-Sent Events get through.
+//
+// A POST without a session ID connects and returns the new session ID along
+// with the first messages. Clients then send GET requests with the `sid`
+// query param to poll for messages, POST requests with `sid` to send commands
+// (subscribe, unsubscribe or message, as WebSocket clients do), and a DELETE
+// with `sid` to disconnect. Sessions without any request for
+// Config.IdleTimeout are disconnected.
+package longpoll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anycable/anycable-go/common"
+	"github.com/apex/log"
+	"github.com/bilus/activego/anycable"
+)
+
+type Config struct {
+	// PollTimeout is how long a poll waits for messages before returning
+	// an empty response.
+	PollTimeout time.Duration
+	// IdleTimeout is how long a session is kept without any request. It
+	// must be longer than PollTimeout.
+	IdleTimeout time.Duration
+	// Headers passed on to the connection, see anycable.FetchHeaders.
+	Headers []string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollTimeout: 25 * time.Second,
+		IdleTimeout: time.Minute,
+		Headers:     anycable.DefaultHeaders,
+	}
+}
+
+// Response is the body of connect and poll responses.
+type Response struct {
+	SID      string            `json:"sid"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+type Handler struct {
+	sessions *anycable.HTTPSessions
+	config   Config
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	stop     chan struct{}
+}
+
+// NewHandler creates a handler for sessions, e.g. EmbeddedAnycable.Sessions(),
+// and starts expiring idle sessions until Shutdown is called. Zero config
+// fields are set to defaults.
+func NewHandler(sessions *anycable.HTTPSessions, config Config) (*Handler, error) {
+	defaults := DefaultConfig()
+	if config.PollTimeout == 0 {
+		config.PollTimeout = defaults.PollTimeout
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.Headers == nil {
+		config.Headers = defaults.Headers
+	}
+	if config.PollTimeout >= config.IdleTimeout {
+		return nil, fmt.Errorf("poll timeout %v must be shorter than idle timeout %v", config.PollTimeout, config.IdleTimeout)
+	}
+	h := &Handler{
+		sessions: sessions,
+		config:   config,
+		lastSeen: make(map[string]time.Time),
+		stop:     make(chan struct{}),
+	}
+	go h.expireIdle()
+	return h, nil
+}
+
+func (h *Handler) Shutdown() {
+	close(h.stop)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sid := r.URL.Query().Get("sid")
+	switch {
+	case r.Method == http.MethodPost && sid == "":
+		h.connect(w, r)
+	case r.Method == http.MethodGet:
+		h.poll(w, r, sid)
+	case r.Method == http.MethodPost:
+		h.command(w, r, sid)
+	case r.Method == http.MethodDelete:
+		h.disconnect(w, sid)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) connect(w http.ResponseWriter, r *http.Request) {
+	uid, err := anycable.NewSessionID()
+	if err != nil {
+		http.Error(w, "UID Retrieval Error", http.StatusInternalServerError)
+		return
+	}
+	session, err := h.sessions.Open(uid, anycable.RequestURL(r), anycable.FetchHeaders(r, h.config.Headers))
+	if session == nil {
+		log.WithField("context", "longpoll").Errorf("Long polling session initialization failed: %v", err)
+		http.Error(w, "session initialization failed", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.PollTimeout)
+	defer cancel()
+	// Sessions are only expired once touched, so this one can't be while
+	// waiting for messages.
+	messages := session.Next(ctx)
+	if err != nil {
+		// Failed authentication: return the disconnect message without a session.
+		uid = ""
+	} else {
+		h.touch(uid)
+	}
+	writeResponse(w, uid, messages)
+}
+
+func (h *Handler) poll(w http.ResponseWriter, r *http.Request, sid string) {
+	session, ok := h.session(w, sid)
+	if !ok {
+		return
+	}
+	// Sessions are touched as polls start too, so that one waiting for
+	// messages is never expired.
+	h.touch(sid)
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.PollTimeout)
+	defer cancel()
+	messages := session.Next(ctx)
+	h.touch(sid)
+	writeResponse(w, sid, messages)
+}
+
+func (h *Handler) command(w http.ResponseWriter, r *http.Request, sid string) {
+	session, ok := h.session(w, sid)
+	if !ok {
+		return
+	}
+	h.touch(sid)
+	msg := common.Message{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "malformed command", http.StatusBadRequest)
+		return
+	}
+	if err := session.Handle(&msg); err != nil {
+		log.WithField("context", "longpoll").Debugf("Long polling command error: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) disconnect(w http.ResponseWriter, sid string) {
+	session, ok := h.session(w, sid)
+	if !ok {
+		return
+	}
+	h.forget(sid)
+	session.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// session looks up the session, responding with 410 Gone if there's none so
+// that clients know to reconnect.
+func (h *Handler) session(w http.ResponseWriter, sid string) (*anycable.HTTPSession, bool) {
+	session, ok := h.sessions.Get(sid)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusGone)
+	}
+	return session, ok
+}
+
+func (h *Handler) touch(sid string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSeen[sid] = time.Now()
+}
+
+func (h *Handler) forget(sid string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.lastSeen, sid)
+}
+
+func (h *Handler) expireIdle() {
+	ticker := time.NewTicker(h.config.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			for _, sid := range h.idle(now) {
+				if session, ok := h.sessions.Get(sid); ok {
+					session.Close()
+				}
+			}
+		}
+	}
+}
+
+func (h *Handler) idle(now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var result []string
+	for sid, seen := range h.lastSeen {
+		if now.Sub(seen) > h.config.IdleTimeout {
+			result = append(result, sid)
+			delete(h.lastSeen, sid)
+		}
+	}
+	return result
+}
+
+func writeResponse(w http.ResponseWriter, sid string, messages [][]byte) {
+	response := Response{SID: sid, Messages: make([]json.RawMessage, len(messages))}
+	for i, msg := range messages {
+		response.Messages[i] = msg
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(response) // nolint:errcheck
+}
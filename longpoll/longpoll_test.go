@@ -0,0 +1,118 @@
+package longpoll_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/longpoll"
+	"github.com/stretchr/testify/require"
+)
+
+func request(t *testing.T, method, url, body string) longpoll.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	response := longpoll.Response{}
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	}
+	return response
+}
+
+func TestLongPoll(t *testing.T) {
+	require := require.New(t)
+
+	disconnected := make(chan struct{})
+	server := activego.BuildServer(nil)
+	server.Disconnected(func(activego.Connection) error {
+		close(disconnected)
+		return nil
+	})
+	server.Channel("ChatChannel").Subscribed(func(c activego.Connection, ch activego.Channel) error {
+		return ch.StreamFrom("chat")
+	})
+	embedded, err := server.Start()
+	require.NoError(err)
+	defer embedded.Shutdown()
+	handler, err := longpoll.NewHandler(embedded.Sessions(), longpoll.Config{
+		PollTimeout: 100 * time.Millisecond,
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	require.NoError(err)
+	defer handler.Shutdown()
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	connected := request(t, http.MethodPost, ts.URL, "")
+	require.NotEmpty(connected.SID)
+	require.Len(connected.Messages, 1)
+	require.JSONEq(`{"type":"welcome"}`, string(connected.Messages[0]))
+
+	url := ts.URL + "?sid=" + connected.SID
+	request(t, http.MethodPost, url, `{"command":"subscribe","identifier":"{\"channel\":\"ChatChannel\"}"}`)
+	require.NoError(server.Broadcaster.Broadcast("chat", "hello"))
+
+	polled := request(t, http.MethodGet, url, "")
+	require.Equal(connected.SID, polled.SID)
+	var messages []string
+	for _, msg := range polled.Messages {
+		messages = append(messages, string(msg))
+	}
+	require.Equal([]string{
+		`{"type":"confirm_subscription","identifier":"{\"channel\":\"ChatChannel\"}"}`,
+		`{"identifier":"{\"channel\":\"ChatChannel\"}","message":"hello"}`,
+	}, messages)
+
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		require.Fail("idle session wasn't disconnected")
+	}
+	resp, err := http.Get(url)
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusGone, resp.StatusCode)
+}
+
+func TestLongPoll_CommandsKeepSessionsAlive(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel")
+	embedded, err := server.Start()
+	require.NoError(err)
+	defer embedded.Shutdown()
+	handler, err := longpoll.NewHandler(embedded.Sessions(), longpoll.Config{
+		PollTimeout: 50 * time.Millisecond,
+		IdleTimeout: 150 * time.Millisecond,
+	})
+	require.NoError(err)
+	defer handler.Shutdown()
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	connected := request(t, http.MethodPost, ts.URL, "")
+	url := ts.URL + "?sid=" + connected.SID
+	for i := 0; i < 10; i++ {
+		resp, err := http.Post(url, "application/json", strings.NewReader(`{"command":"unsubscribe","identifier":"{\"channel\":\"ChatChannel\"}"}`))
+		require.NoError(err)
+		resp.Body.Close()
+		require.Equal(http.StatusAccepted, resp.StatusCode)
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNewHandler_PollTimeoutShorterThanIdleTimeout(t *testing.T) {
+	_, err := longpoll.NewHandler(nil, longpoll.Config{
+		PollTimeout: time.Minute,
+		IdleTimeout: time.Minute,
+	})
+	require.Error(t, err)
+}
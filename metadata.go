@@ -0,0 +1,40 @@
+package activego
+
+import (
+	context "context"
+	"strings"
+
+	"github.com/bilus/activego/anycable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SupportedProtocolVersions lists the RPC protocol versions the server
+// implements, most preferred first.
+var SupportedProtocolVersions = []string{"v1"}
+
+// RequestMetadata is what the node sends along with an RPC call.
+type RequestMetadata struct {
+	SessionID string
+	// ProtocolVersion is the RPC protocol version negotiated with the node.
+	ProtocolVersion string
+}
+
+// requestMetadata returns the metadata of an RPC call. Calls without a
+// protov header (e.g. made directly in tests) are assumed to speak the
+// preferred version.
+func requestMetadata(c context.Context) (RequestMetadata, error) {
+	sessionID, protoVersions := anycable.FromIncomingContext(c)
+	if protoVersions == "" {
+		return RequestMetadata{sessionID, SupportedProtocolVersions[0]}, nil
+	}
+	for _, supported := range SupportedProtocolVersions {
+		for _, offered := range strings.Split(protoVersions, ",") {
+			if strings.TrimSpace(offered) == supported {
+				return RequestMetadata{sessionID, supported}, nil
+			}
+		}
+	}
+	return RequestMetadata{}, status.Errorf(codes.FailedPrecondition, "unsupported RPC protocol version %q (supported: %s)",
+		protoVersions, strings.Join(SupportedProtocolVersions, ","))
+}
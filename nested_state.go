@@ -2,35 +2,46 @@ package activego
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
+// nestedState holds per-channel states, decoding a channel's state when it's
+// first selected.
 type nestedState struct {
+	raw   map[string]string
 	m     map[string]*simpleState
 	focus *simpleState // TODO: Brittle, have to call Select before anything else.
+	codec Codec
 }
 
 func DecodeNestedState(src map[string]string) (*nestedState, error) {
-	state := nestedState{
-		m: make(map[string]*simpleState),
-	}
-	for k, js := range src {
-		var m map[string]string
-		if err := json.Unmarshal([]byte(js), &m); err != nil {
-			return nil, err
-		}
-		var err error
-		state.m[k], err = DecodeSimpleState(m)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return &state, nil
+	return DecodeNestedStateWith(DefaultCodec, src)
 }
 
-func (state nestedState) Get(k string) interface{} {
+// DecodeNestedStateWith returns per-channel states whose values are encoded
+// with the codec. The outer maps are always JSON as sent by anycable.
+func DecodeNestedStateWith(codec Codec, src map[string]string) (*nestedState, error) {
+	return &nestedState{
+		raw:   src,
+		m:     make(map[string]*simpleState),
+		codec: codec,
+	}, nil
+}
+
+func (state *nestedState) Get(k string) interface{} {
 	return state.focus.Get(k)
 }
 
+// Err returns the first error decoding the state of a selected channel.
+func (state *nestedState) Err() error {
+	for _, s := range state.m {
+		if s.err != nil {
+			return s.err
+		}
+	}
+	return nil
+}
+
 func (state *nestedState) Set(k string, v interface{}) {
 	state.focus.Set(k, v)
 }
@@ -45,7 +56,7 @@ func (state *nestedState) UpdateFloat64(k string, f func(float64) float64) error
 
 // TODO: UpdateMap, UpdateBool, Update
 
-func (state nestedState) Changes() (map[string]string, error) {
+func (state *nestedState) Changes() (map[string]string, error) {
 	result := make(map[string]string)
 	for k := range state.m {
 		s := state.m[k]
@@ -65,8 +76,17 @@ func (state nestedState) Changes() (map[string]string, error) {
 func (state *nestedState) Select(k string) {
 	var ok bool
 	state.focus, ok = state.m[k]
-	if !ok {
-		state.focus = NewSimpleState(nil)
-		state.m[k] = state.focus
+	if ok {
+		return
+	}
+	var m map[string]string
+	var err error
+	if js, ok := state.raw[k]; ok {
+		if err = json.Unmarshal([]byte(js), &m); err != nil {
+			err = fmt.Errorf("error decoding state of channel %q: %w", k, err)
+		}
 	}
+	state.focus, _ = DecodeSimpleStateWith(state.codec, m)
+	state.focus.err = err
+	state.m[k] = state.focus
 }
@@ -0,0 +1,157 @@
+package activego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidParams is returned for identifiers whose params don't match the
+// schema declared with ChannelBuilder.Params. Subscriptions with them are
+// rejected.
+var ErrInvalidParams = errors.New("invalid channel params")
+
+// ParamsValidator is implemented by params structs with validation rules
+// beyond the `params:"required"` tag.
+type ParamsValidator interface {
+	Validate() error
+}
+
+// paramsSchema decodes identifier params into a struct.
+type paramsSchema struct {
+	typ      reflect.Type
+	fields   []string
+	index    [][]int
+	required []string
+}
+
+func newParamsSchema(prototype interface{}) (*paramsSchema, error) {
+	typ := reflect.TypeOf(prototype)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params must be a struct, got %T", prototype)
+	}
+	schema := &paramsSchema{typ: typ}
+	// Fields of embedded structs are flattened as encoding/json does:
+	// shallower fields hide deeper ones with the same name. Structs are
+	// walked breadth first, holding the index of their fields.
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	depths := make(map[string]int)
+	visited := map[reflect.Type]bool{typ: true}
+	level := []embedded{{typ, nil}}
+	for depth := 0; len(level) > 0; depth++ {
+		var next []embedded
+		for _, s := range level {
+			for i := 0; i < s.typ.NumField(); i++ {
+				field := s.typ.Field(i)
+				index := append(append([]int{}, s.index...), i)
+				name := strings.Split(field.Tag.Get("json"), ",")[0]
+				if name == "-" {
+					continue
+				}
+				if field.Anonymous && name == "" {
+					t := field.Type
+					if t.Kind() == reflect.Ptr {
+						t = t.Elem()
+						if field.PkgPath != "" && t.Kind() == reflect.Struct {
+							return nil, fmt.Errorf("params field %s: embedded pointers to unexported structs can't be set", field.Name)
+						}
+					}
+					if t.Kind() == reflect.Struct {
+						if !visited[t] {
+							visited[t] = true
+							next = append(next, embedded{t, index})
+						}
+						continue
+					}
+				}
+				if field.PkgPath != "" {
+					continue
+				}
+				if name == "" {
+					name = field.Name
+				}
+				if d, ok := depths[name]; ok {
+					if d == depth {
+						return nil, fmt.Errorf("params field %q is declared twice", name)
+					}
+					continue
+				}
+				depths[name] = depth
+				schema.fields = append(schema.fields, name)
+				schema.index = append(schema.index, index)
+				if field.Tag.Get("params") == "required" {
+					schema.required = append(schema.required, name)
+				}
+			}
+		}
+		level = next
+	}
+	return schema, nil
+}
+
+// decode returns a pointer to a new struct holding the identifier's params,
+// matched to fields by their JSON names, and an error if they don't match
+// the schema. Missing and null required params are both invalid. The struct
+// is returned even then, holding what could be decoded: params are only
+// checked on subscribe, so that subscriptions made before the schema changed
+// can still unsubscribe.
+func (schema *paramsSchema) decode(identifier ChannelIdentifier) (interface{}, error) {
+	ptr := reflect.New(schema.typ)
+	params := ptr.Interface()
+	for i, name := range schema.fields {
+		raw, ok := identifier.params[name]
+		if !ok {
+			continue
+		}
+		field := fieldByIndex(ptr.Elem(), schema.index[i]).Addr().Interface()
+		if err := json.Unmarshal(raw, field); err != nil {
+			return params, fmt.Errorf("%w: %q: %v", ErrInvalidParams, name, err)
+		}
+	}
+	for _, name := range schema.required {
+		if raw, ok := identifier.params[name]; !ok || string(raw) == "null" {
+			return params, fmt.Errorf("%w: missing %q", ErrInvalidParams, name)
+		}
+	}
+	if validator, ok := params.(ParamsValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return params, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+		}
+	}
+	return params, nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex allocating the embedded struct
+// pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// paramsChecker is implemented by channels with params declared with
+// ChannelBuilder.Params.
+type paramsChecker interface {
+	// checkParams returns an error wrapping ErrInvalidParams if the params
+	// don't match the schema.
+	checkParams() error
+}
+
+func (c ChannelController) checkParams() error {
+	return c.paramsErr
+}
@@ -0,0 +1,149 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+type RoomParams struct {
+	Room  string `json:"room" params:"required"`
+	Limit int    `json:"limit"`
+}
+
+func (p *RoomParams) Validate() error {
+	if p.Limit < 0 {
+		return errors.New("negative limit")
+	}
+	return nil
+}
+
+func TestParams(t *testing.T) {
+	require := require.New(t)
+
+	var params *RoomParams
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Params(RoomParams{}).
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			params = ch.Params().(*RoomParams)
+			return nil
+		})
+
+	subscribe := func(identifier string) *anycable.CommandResponse {
+		r, err := server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "subscribe",
+			Identifier:            identifier,
+			ConnectionIdentifiers: `{}`,
+			Env:                   &anycable.Env{},
+		})
+		require.NoError(err)
+		return r
+	}
+
+	r := subscribe(`{"channel":"RoomChannel","room":"lobby","limit":10}`)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal(&RoomParams{Room: "lobby", Limit: 10}, params)
+
+	for _, identifier := range []string{
+		`{"channel":"RoomChannel"}`,
+		`{"channel":"RoomChannel","room":null}`,
+		`{"channel":"RoomChannel","room":1}`,
+		`{"channel":"RoomChannel","room":"lobby","limit":-1}`,
+	} {
+		r := subscribe(identifier)
+		require.Equal(anycable.Status_FAILURE, r.Status, identifier)
+		require.Len(r.Transmissions, 1)
+		require.Contains(r.Transmissions[0], "reject_subscription")
+	}
+}
+
+func TestParams_NotCheckedOnUnsubscribe(t *testing.T) {
+	require := require.New(t)
+
+	var params *RoomParams
+	server := activego.BuildServer(nil)
+	server.Channel("RoomChannel").
+		Params(RoomParams{}).
+		Unsubscribed(func(c activego.Connection, ch activego.Channel) error {
+			params = ch.Params().(*RoomParams)
+			return nil
+		})
+
+	r, err := server.Command(context.Background(), &anycable.CommandMessage{
+		Command:               "unsubscribe",
+		Identifier:            `{"channel":"RoomChannel","room":"lobby","limit":-1}`,
+		ConnectionIdentifiers: `{}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal(&RoomParams{Room: "lobby", Limit: -1}, params)
+}
+
+func TestParams_NotAStruct(t *testing.T) {
+	server := activego.NewServerBuilder()
+	server.Channel("RoomChannel").Params("room")
+	_, err := server.Start()
+	require.Error(t, err)
+}
+
+type Paging struct {
+	Page int `json:"page" params:"required"`
+}
+
+type Sorting struct {
+	Order string `json:"order"`
+	Limit int    `json:"limit"`
+}
+
+type ListParams struct {
+	Paging
+	*Sorting
+	// Hides Sorting.Limit.
+	Limit int `json:"limit"`
+}
+
+func TestParams_Embedded(t *testing.T) {
+	require := require.New(t)
+
+	var params *ListParams
+	server := activego.BuildServer(nil)
+	server.Channel("ListChannel").
+		Params(ListParams{}).
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			params = ch.Params().(*ListParams)
+			return nil
+		})
+
+	subscribe := func(identifier string) anycable.Status {
+		r, err := server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "subscribe",
+			Identifier:            identifier,
+			ConnectionIdentifiers: `{}`,
+			Env:                   &anycable.Env{},
+		})
+		require.NoError(err)
+		return r.Status
+	}
+
+	require.Equal(anycable.Status_SUCCESS, subscribe(`{"channel":"ListChannel","page":2,"order":"asc","limit":5}`))
+	require.Equal(&ListParams{Paging: Paging{Page: 2}, Sorting: &Sorting{Order: "asc"}, Limit: 5}, params)
+	require.Equal(anycable.Status_FAILURE, subscribe(`{"channel":"ListChannel","order":"asc"}`))
+}
+
+func TestParams_EmbeddedConflict(t *testing.T) {
+	type Cursor struct{ Page string }
+	type Offset struct{ Page int }
+	server := activego.NewServerBuilder()
+	server.Channel("ListChannel").Params(struct {
+		Cursor
+		Offset
+	}{})
+	_, err := server.Start()
+	require.Error(t, err)
+}
@@ -1,21 +1,110 @@
 package activego
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransmission is returned for transmissions that don't conform to
+// the ActionCable protocol.
+var ErrInvalidTransmission = errors.New("invalid transmission")
+
+// Transmission is a message sent to the client over the connection. Only the
+// protocol types below implement it; see Connection.TransmitRaw for sending
+// anything else.
+type Transmission interface {
+	Validate() error
+	transmission()
+}
+
+func invalidTransmission(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTransmission, fmt.Sprintf(format, args...))
+}
+
+func expectType(actual, expected string) error {
+	if actual != expected {
+		return invalidTransmission("type %q, expected %q", actual, expected)
+	}
+	return nil
+}
+
 type WelcomeResponseTransmission struct {
 	Type string `json:"type"`
 }
 
+func (WelcomeResponseTransmission) transmission() {}
+
+func (t WelcomeResponseTransmission) Validate() error {
+	return expectType(t.Type, "welcome")
+}
+
 type DisconnectResponseTransmission struct {
 	Type      string `json:"type"`
 	Reason    string `json:"reason"`
 	Reconnect bool   `json:"reconnect"`
 }
 
+func (DisconnectResponseTransmission) transmission() {}
+
+func (t DisconnectResponseTransmission) Validate() error {
+	return expectType(t.Type, "disconnect")
+}
+
 type MessageResponseTransmission struct {
 	Message    interface{} `json:"message"`
 	Identifier string      `json:"identifier"`
 }
 
+func (MessageResponseTransmission) transmission() {}
+
+func (t MessageResponseTransmission) Validate() error {
+	if t.Identifier == "" {
+		return invalidTransmission("message without identifier")
+	}
+	return nil
+}
+
 type CommandResponseTransmission struct {
 	Type       string `json:"type"`
 	Identifier string `json:"identifier"`
 }
+
+func (CommandResponseTransmission) transmission() {}
+
+func (t CommandResponseTransmission) Validate() error {
+	if t.Type != "confirm_subscription" && t.Type != "reject_subscription" {
+		return invalidTransmission("type %q, expected %q or %q", t.Type, "confirm_subscription", "reject_subscription")
+	}
+	if t.Identifier == "" {
+		return invalidTransmission("%s without identifier", t.Type)
+	}
+	return nil
+}
+
+type WhisperTransmission struct {
+	Type    string                `json:"type"`
+	From    ConnectionIdentifiers `json:"from"`
+	Message interface{}           `json:"message"`
+}
+
+func (WhisperTransmission) transmission() {}
+
+func (t WhisperTransmission) Validate() error {
+	return expectType(t.Type, "whisper")
+}
+
+// ErrorMessage is sent as the message of a MessageResponseTransmission to
+// report a failure to the subscription.
+type ErrorMessage struct {
+	Type      string      `json:"type"`
+	CommandID interface{} `json:"command_id,omitempty"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+}
+
+// AckMessage is sent as the message of a MessageResponseTransmission to
+// confirm that the action with the command ID has been handled.
+type AckMessage struct {
+	Type      string      `json:"type"`
+	CommandID interface{} `json:"command_id"`
+}
@@ -0,0 +1,36 @@
+package activego_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransmission_Validate(t *testing.T) {
+	valid := []activego.Transmission{
+		activego.WelcomeResponseTransmission{Type: "welcome"},
+		activego.DisconnectResponseTransmission{Type: "disconnect", Reason: "unauthorized"},
+		activego.MessageResponseTransmission{Message: "hello", Identifier: `{"channel":"ChatChannel"}`},
+		activego.MessageResponseTransmission{Identifier: `{"channel":"ChatChannel"}`},
+		activego.CommandResponseTransmission{Type: "confirm_subscription", Identifier: `{"channel":"ChatChannel"}`},
+		activego.WhisperTransmission{Type: "whisper", Message: "typing"},
+	}
+	for _, transmission := range valid {
+		require.NoError(t, transmission.Validate(), "%#v", transmission)
+	}
+
+	invalid := []activego.Transmission{
+		activego.WelcomeResponseTransmission{},
+		activego.DisconnectResponseTransmission{Type: "welcome"},
+		activego.MessageResponseTransmission{Message: "hello"},
+		activego.CommandResponseTransmission{Type: "confirm", Identifier: `{"channel":"ChatChannel"}`},
+		activego.CommandResponseTransmission{Type: "reject_subscription"},
+		activego.WhisperTransmission{Message: "typing"},
+	}
+	for _, transmission := range invalid {
+		err := transmission.Validate()
+		require.True(t, errors.Is(err, activego.ErrInvalidTransmission), "%#v: %v", transmission, err)
+	}
+}
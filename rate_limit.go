@@ -0,0 +1,108 @@
+package activego
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bilus/activego/anycable"
+	"github.com/bilus/activego/ratelimit"
+)
+
+// RateLimit throttles message commands using a token bucket refilled at Rate
+// tokens per second, holding at most Burst tokens.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+	// Disconnect closes the connection when the limit is exceeded instead of
+	// transmitting an error to the subscription.
+	Disconnect bool
+
+	limiter *ratelimit.Limiter
+}
+
+func newRateLimit(limit RateLimit) *RateLimit {
+	limit.limiter = ratelimit.NewLimiter(limit.Rate, limit.Burst)
+	return &limit
+}
+
+func actionKey(channel, action string) string {
+	return channel + "#" + action
+}
+
+// rateLimitKey is the key of the connection's buckets: its session ID or,
+// if the node didn't send one, its identifiers.
+func rateLimitKey(md RequestMetadata, identifiers string) string {
+	if md.SessionID != "" {
+		return md.SessionID
+	}
+	return identifiers
+}
+
+// exceededRateLimit returns the rate limit the message command exceeds, if any.
+// Buckets are kept per connection and, for action limits, also per channel.
+func (s *Server) exceededRateLimit(md RequestMetadata, m *anycable.CommandMessage, identifier ChannelIdentifier) *RateLimit {
+	if m.Command != "message" {
+		return nil
+	}
+	key := rateLimitKey(md, m.ConnectionIdentifiers)
+	if limit := s.connectionRateLimit; limit != nil && !limit.limiter.Allow(key) {
+		return limit
+	}
+	if len(s.actionRateLimits) == 0 {
+		return nil
+	}
+	var data struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal([]byte(m.Data), &data); err != nil {
+		return nil
+	}
+	limit, ok := s.actionRateLimits[actionKey(s.channelKey(identifier.Name()), data.Action)]
+	if !ok || limit.limiter.AllowFor(key, identifier.Name()) {
+		return nil
+	}
+	return limit
+}
+
+// forgetRateLimits drops the buckets of a closed connection.
+func (s *Server) forgetRateLimits(md RequestMetadata, identifiers string) {
+	key := rateLimitKey(md, identifiers)
+	if s.connectionRateLimit != nil {
+		s.connectionRateLimit.limiter.Forget(key)
+	}
+	for _, limit := range s.actionRateLimits {
+		limit.limiter.Forget(key)
+	}
+}
+
+func (s *Server) rateLimited(socket *Socket, m *anycable.CommandMessage, limit *RateLimit) (*anycable.CommandResponse, error) {
+	var err error
+	if limit.Disconnect {
+		err = socket.Disconnect("rate_limited", false)
+	} else {
+		var data struct {
+			CommandID interface{} `json:"command_id"`
+		}
+		json.Unmarshal([]byte(m.Data), &data) // nolint:errcheck
+		err = socket.Transmit(MessageResponseTransmission{
+			Message: ErrorMessage{
+				Type:      "error",
+				CommandID: data.CommandID,
+				Code:      "rate_limited",
+				Message:   "Rate limit exceeded",
+			},
+			Identifier: m.Identifier,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	response := anycable.CommandResponse{
+		Status:   anycable.Status_FAILURE,
+		ErrorMsg: fmt.Sprintf("Rate limit exceeded for command %q", m.Command),
+	}
+	if err := socket.SaveToCommandResponse(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,85 @@
+package activego_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func performMessage(action string) *anycable.CommandMessage {
+	return &anycable.CommandMessage{
+		Command:               "message",
+		Identifier:            `{"channel":"ChatChannel"}`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Data:                  `{"action":"` + action + `"}`,
+		Env:                   &anycable.Env{},
+	}
+}
+
+func TestRateLimit_Action_TransmitsError(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error { return nil }).
+		RateLimit("speak", activego.RateLimit{Rate: 0.001, Burst: 1})
+
+	r, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+
+	r, err = server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.False(r.Disconnect)
+	require.Len(r.Transmissions, 1)
+	require.Contains(r.Transmissions[0], `"code":"rate_limited"`)
+}
+
+func TestRateLimit_Connection_Disconnects(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.RateLimit(activego.RateLimit{Rate: 0.001, Burst: 1, Disconnect: true})
+	server.Channel("ChatChannel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error { return nil })
+
+	_, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+
+	r, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.True(r.Disconnect)
+	require.Equal([]string{`{"type":"disconnect","reason":"rate_limited","reconnect":false}`}, r.Transmissions)
+}
+
+func TestRateLimit_PerSession(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{}))
+	server.Channel("ChatChannel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error { return nil }).
+		RateLimit("speak", activego.RateLimit{Rate: 0.001, Burst: 1})
+
+	perform := func(sid string) anycable.Status {
+		m := performMessage("speak")
+		m.ConnectionIdentifiers = `{}`
+		r, err := server.Command(anycable.NewIncomingContext(context.Background(), sid, "v1"), m)
+		require.NoError(err)
+		return r.Status
+	}
+	require.Equal(anycable.Status_SUCCESS, perform("sid1"))
+	require.Equal(anycable.Status_FAILURE, perform("sid1"))
+	// Anonymous connections don't share buckets.
+	require.Equal(anycable.Status_SUCCESS, perform("sid2"))
+
+	_, err := server.Disconnect(anycable.NewIncomingContext(context.Background(), "sid1", "v1"), &anycable.DisconnectRequest{
+		Identifiers: `{}`,
+		Env:         &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, perform("sid1"))
+}
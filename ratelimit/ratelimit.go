@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at Rate tokens per second up to Burst tokens.
+type Bucket struct {
+	Rate  float64
+	Burst int
+
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{Rate: rate, Burst: burst, tokens: float64(burst)}
+}
+
+// Allow takes a token from the bucket if there is one.
+func (b *Bucket) Allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.Rate
+		if b.tokens > float64(b.Burst) {
+			b.tokens = float64(b.Burst)
+		}
+	}
+	b.last = now
+}
+
+// full reports whether the bucket would be full at the given time, i.e. it is
+// indistinguishable from a new one and can be dropped.
+func (b *Bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.Rate >= float64(b.Burst)
+}
+
+// Limiter keeps a token bucket per key. It is safe for concurrent use.
+type Limiter struct {
+	rate  float64
+	burst int
+
+	mu sync.Mutex
+	// Maps owners to keys to buckets.
+	buckets   map[string]map[string]*Bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]map[string]*Bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether an event for the key may happen now.
+func (l *Limiter) Allow(key string) bool {
+	return l.AllowFor(key, "")
+}
+
+// AllowFor is Allow for one of several buckets of an owner, e.g. the buckets
+// of a connection per channel, which Forget drops at once.
+func (l *Limiter) AllowFor(owner, key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	buckets, ok := l.buckets[owner]
+	if !ok {
+		buckets = make(map[string]*Bucket)
+		l.buckets[owner] = buckets
+	}
+	b, ok := buckets[key]
+	if !ok {
+		b = NewBucket(l.rate, l.burst)
+		buckets[key] = b
+	}
+	return b.Allow(now)
+}
+
+// Forget drops the buckets of the key or owner, e.g. when a connection goes
+// away.
+func (l *Limiter) Forget(owner string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, owner)
+}
+
+// sweep drops buckets that have refilled completely so idle keys don't pile up.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for owner, buckets := range l.buckets {
+		for k, b := range buckets {
+			if b.full(now) {
+				delete(buckets, k)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(l.buckets, owner)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bilus/activego/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit_Bucket_Burst(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	b := ratelimit.NewBucket(1, 2)
+	require.True(b.Allow(now))
+	require.True(b.Allow(now))
+	require.False(b.Allow(now))
+}
+
+func TestRateLimit_Bucket_Refill(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	b := ratelimit.NewBucket(2, 1)
+	require.True(b.Allow(now))
+	require.False(b.Allow(now.Add(100 * time.Millisecond)))
+	require.True(b.Allow(now.Add(600 * time.Millisecond)))
+}
+
+func TestRateLimit_Limiter_PerKey(t *testing.T) {
+	require := require.New(t)
+
+	l := ratelimit.NewLimiter(0.001, 1)
+	require.True(l.Allow("a"))
+	require.False(l.Allow("a"))
+	require.True(l.Allow("b"))
+	l.Forget("a")
+	require.True(l.Allow("a"))
+}
+
+func TestRateLimit_Limiter_ForgetOwner(t *testing.T) {
+	require := require.New(t)
+
+	l := ratelimit.NewLimiter(0.001, 1)
+	require.True(l.AllowFor("a", "x"))
+	require.True(l.AllowFor("a", "y"))
+	require.False(l.AllowFor("a", "x"))
+	require.True(l.AllowFor("b", "x"))
+	l.Forget("a")
+	require.True(l.AllowFor("a", "x"))
+	require.True(l.AllowFor("a", "y"))
+}
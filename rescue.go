@@ -0,0 +1,165 @@
+package activego
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/apex/log"
+)
+
+// ErrorHandler handles an error returned while subscribing, unsubscribing
+// or performing an action. Returning nil marks the error as handled: the
+// command succeeds, except for subscriptions, which are rejected. Returning
+// an error fails the command with it. Actions with a command ID are
+// acknowledged with the outcome unless the handler reported it, e.g. with
+// TransmitError.
+type ErrorHandler func(c Connection, ch Channel, err error) error
+
+// ActionError is the error passed to error handlers when an action fails.
+type ActionError struct {
+	Action    string
+	CommandID interface{}
+	Err       error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("error handling action %q: %v", e.Action, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// TransmitError transmits an ErrorMessage to the subscription. The code and
+// message of CommandErrors are sent as is, other errors are reported as
+// internal errors.
+func TransmitError(c Connection, ch Channel, err error) error {
+	var commandID interface{}
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		commandID = actionErr.CommandID
+	}
+	return ch.Transmit(newErrorMessage(commandID, err))
+}
+
+// LogError logs the error.
+func LogError(c Connection, ch Channel, err error) error {
+	log.WithField("channel", ch.Name()).WithError(err).Error("Error handling command")
+	return nil
+}
+
+// DisconnectOnError logs the error and closes the connection, letting the
+// client reconnect.
+func DisconnectOnError(c Connection, ch Channel, err error) error {
+	LogError(c, ch, err)
+	return c.Close("server_error", true)
+}
+
+// ErrorHandlers combines handlers run in order until one returns an error,
+// e.g. `ErrorHandlers(LogError, TransmitError)`.
+func ErrorHandlers(handlers ...ErrorHandler) ErrorHandler {
+	return func(c Connection, ch Channel, err error) error {
+		for _, handler := range handlers {
+			if err := handler(c, ch, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func newErrorMessage(commandID interface{}, err error) ErrorMessage {
+	commandErr := &CommandError{Code: "internal_error", Message: "Internal error"}
+	errors.As(err, &commandErr)
+	return ErrorMessage{
+		Type:      "error",
+		CommandID: commandID,
+		Code:      commandErr.Code,
+		Message:   commandErr.Message,
+	}
+}
+
+// rescuer handles errors matching a RescueFrom target.
+type rescuer struct {
+	match   func(error) bool
+	handler ErrorHandler
+}
+
+// newRescuer matches errors with errors.Is, or with errors.As if the target
+// is a nil pointer of an error type.
+func newRescuer(target error, handler ErrorHandler) (rescuer, error) {
+	v := reflect.ValueOf(target)
+	switch {
+	case target == nil:
+		return rescuer{}, errors.New("nil error to rescue from")
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		typ := v.Type()
+		return rescuer{func(err error) bool {
+			return errors.As(err, reflect.New(typ).Interface())
+		}, handler}, nil
+	default:
+		return rescuer{func(err error) bool {
+			return errors.Is(err, target)
+		}, handler}, nil
+	}
+}
+
+// rescue runs the handler of the first rescuer of the channel, then of the
+// server, matching the error, falling back to the default error handler.
+// It reports whether any handler ran.
+func (c ChannelController) rescue(err error) (bool, error) {
+	for _, rescuers := range [][]rescuer{c.handlers.rescuers, c.server.rescuers} {
+		for _, r := range rescuers {
+			if r.match(err) {
+				return true, r.handler(c.connection, c.Channel, err)
+			}
+		}
+	}
+	if c.server.errorHandler != nil {
+		return true, c.server.errorHandler(c.connection, c.Channel, err)
+	}
+	return false, err
+}
+
+// errorRescuer is implemented by channels handling errors of commands.
+type errorRescuer interface {
+	rescue(err error) (bool, error)
+}
+
+// RescueFrom handles errors of the channel matching the target. A nil
+// pointer of an error type, e.g. `(*NotFoundError)(nil)`, matches errors of
+// that type; other errors are matched with errors.Is. Handlers are tried in
+// the order they were registered, before those of the server.
+func (b *ChannelBuilder) RescueFrom(target error, handler ErrorHandler) *ChannelBuilder {
+	b.builder.register(func() {
+		r, err := newRescuer(target, handler)
+		if err != nil {
+			b.builder.problems = append(b.builder.problems, fmt.Errorf("channel %q: %v", b.name, err))
+			return
+		}
+		b.handlers.rescuers = append(b.handlers.rescuers, r)
+	})
+	return b
+}
+
+// RescueFrom handles errors of all channels matching the target; see
+// ChannelBuilder.RescueFrom.
+func (b *ServerBuilder) RescueFrom(target error, handler ErrorHandler) *ServerBuilder {
+	b.register(func() {
+		r, err := newRescuer(target, handler)
+		if err != nil {
+			b.problems = append(b.problems, err)
+			return
+		}
+		b.handlers.rescuers = append(b.handlers.rescuers, r)
+	})
+	return b
+}
+
+// DefaultErrorHandler handles errors no RescueFrom handler matches. Without
+// it, such errors fail the command without notifying the client.
+func (b *ServerBuilder) DefaultErrorHandler(handler ErrorHandler) *ServerBuilder {
+	b.register(func() { b.handlers.errorHandler = handler })
+	return b
+}
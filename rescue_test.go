@@ -0,0 +1,128 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+type notFoundError struct {
+	id string
+}
+
+func (e *notFoundError) Error() string {
+	return "not found: " + e.id
+}
+
+var errForbidden = errors.New("forbidden")
+
+func failingWith(err error) activego.ActionHandler {
+	return func(activego.Connection, activego.Channel, activego.ActionData) error {
+		return err
+	}
+}
+
+func TestRescueFrom(t *testing.T) {
+	require := require.New(t)
+
+	var rescued []string
+	rescueAs := func(name string) activego.ErrorHandler {
+		return func(c activego.Connection, ch activego.Channel, err error) error {
+			rescued = append(rescued, name)
+			return nil
+		}
+	}
+	server := activego.BuildServer(nil)
+	server.RescueFrom(errForbidden, rescueAs("server forbidden"))
+	server.Channel("ChatChannel").
+		Received("find", failingWith(&notFoundError{"42"})).
+		Received("forbid", failingWith(errForbidden)).
+		Received("fail", failingWith(errors.New("boom"))).
+		RescueFrom((*notFoundError)(nil), rescueAs("not found"))
+
+	perform := func(action string) anycable.Status {
+		r, err := server.Command(context.Background(), performMessage(action))
+		require.NoError(err)
+		return r.Status
+	}
+	require.Equal(anycable.Status_SUCCESS, perform("find"))
+	require.Equal(anycable.Status_SUCCESS, perform("forbid"))
+	require.Equal(anycable.Status_FAILURE, perform("fail"))
+	require.Equal([]string{"not found", "server forbidden"}, rescued)
+}
+
+func TestRescueFrom_Acknowledged(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("find", failingWith(&notFoundError{"42"})).
+		Received("forbid", failingWith(errForbidden)).
+		RescueFrom((*notFoundError)(nil), activego.LogError).
+		RescueFrom(errForbidden, func(c activego.Connection, ch activego.Channel, err error) error {
+			return activego.NewCommandError("forbidden", "Not allowed")
+		})
+
+	perform := func(action string) *anycable.CommandResponse {
+		m := performMessage(action)
+		m.Data = `{"action":"` + action + `","command_id":7}`
+		r, err := server.Command(context.Background(), m)
+		require.NoError(err)
+		return r
+	}
+	r := perform("find")
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{
+		`{"message":{"type":"ack","command_id":7},"identifier":"{\"channel\":\"ChatChannel\"}"}`,
+	}, r.Transmissions)
+	r = perform("forbid")
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{
+		`{"message":{"type":"error","command_id":7,"code":"forbidden","message":"Not allowed"},"identifier":"{\"channel\":\"ChatChannel\"}"}`,
+	}, r.Transmissions)
+}
+
+func TestDefaultErrorHandler_TransmitError(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.DefaultErrorHandler(activego.ErrorHandlers(activego.LogError, activego.TransmitError))
+	server.Channel("ChatChannel").
+		Received("speak", failingWith(activego.NewCommandError("too_long", "Message too long"))).
+		Subscribed(func(activego.Connection, activego.Channel) error { return errForbidden })
+
+	m := performMessage("speak")
+	m.Data = `{"action":"speak","command_id":7}`
+	r, err := server.Command(context.Background(), m)
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{
+		`{"message":{"type":"error","command_id":7,"code":"too_long","message":"Message too long"},"identifier":"{\"channel\":\"ChatChannel\"}"}`,
+	}, r.Transmissions)
+
+	r, err = subscribeTo(server, "ChatChannel")
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{
+		`{"message":{"type":"error","code":"internal_error","message":"Internal error"},"identifier":"{\"channel\":\"ChatChannel\"}"}`,
+		`{"type":"reject_subscription","identifier":"{\"channel\":\"ChatChannel\"}"}`,
+	}, r.Transmissions)
+}
+
+func TestDefaultErrorHandler_DisconnectOnError(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.DefaultErrorHandler(activego.DisconnectOnError)
+	server.Channel("ChatChannel").Received("speak", failingWith(errors.New("boom")))
+
+	r, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.True(r.Disconnect)
+	require.Equal([]string{`{"type":"disconnect","reason":"server_error","reconnect":true}`}, r.Transmissions)
+}
@@ -0,0 +1,105 @@
+package activego
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownChannel is returned for identifiers of channels no handlers are
+// registered for. Subscriptions to them are rejected.
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// NamespaceSeparator separates namespaces in channel names, as Ruby modules
+// do in ActionCable channel class names.
+const NamespaceSeparator = "::"
+
+// fallbackKey is the registration key of the fallback channel. Channels
+// can't be named with an empty string, so it never collides.
+const fallbackKey = ""
+
+// channelRoute matches channel names against a pattern.
+type channelRoute struct {
+	match    func(name string) bool
+	handlers *channelHandlers
+}
+
+// route finds the handlers of a channel. Exact names take precedence over
+// patterns, which are tried in the order they were registered, and the
+// fallback channel comes last.
+func (h *connectionHandlers) route(name string) (*channelHandlers, bool) {
+	if handlers, ok := h.channels[name]; ok {
+		return handlers, true
+	}
+	for _, route := range h.routes {
+		if route.match(name) {
+			return route.handlers, true
+		}
+	}
+	if h.fallback != nil {
+		return h.fallback, true
+	}
+	return nil, false
+}
+
+// registered returns handlers of all registrations: channels sorted by name,
+// then patterns and the fallback channel.
+func (h *connectionHandlers) registered() []*channelHandlers {
+	names := make([]string, 0, len(h.channels))
+	for name := range h.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	all := make([]*channelHandlers, 0, len(names)+len(h.routes)+1)
+	for _, name := range names {
+		all = append(all, h.channels[name])
+	}
+	for _, route := range h.routes {
+		all = append(all, route.handlers)
+	}
+	if h.fallback != nil {
+		all = append(all, h.fallback)
+	}
+	return all
+}
+
+// globMatcher matches names against a pattern where `*` stands for any
+// sequence of characters, namespace separators included.
+func globMatcher(pattern string) func(string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString
+}
+
+// Namespace registers channels whose names share a prefix, e.g.
+// `Chat::RoomChannel` and `Chat::DirectChannel` in the `Chat` namespace.
+type Namespace struct {
+	builder *ServerBuilder
+	prefix  string
+}
+
+// Namespace returns a namespace for channels named with the prefix followed
+// by NamespaceSeparator.
+func (b *ServerBuilder) Namespace(prefix string) *Namespace {
+	return &Namespace{b, prefix + NamespaceSeparator}
+}
+
+// Namespace returns a namespace nested in this one.
+func (n *Namespace) Namespace(prefix string) *Namespace {
+	return &Namespace{n.builder, n.prefix + prefix + NamespaceSeparator}
+}
+
+// Channel registers a channel of the namespace.
+func (n *Namespace) Channel(name string) *ChannelBuilder {
+	return n.builder.Channel(n.prefix + name)
+}
+
+// Channels registers handlers for channels of the namespace matching the
+// pattern (see ServerBuilder.Channels). Channels("*") matches the whole
+// namespace, nested namespaces included.
+func (n *Namespace) Channels(pattern string) *ChannelBuilder {
+	return n.builder.Channels(n.prefix + pattern)
+}
@@ -0,0 +1,99 @@
+package activego_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+func subscribeTo(server *activego.ServerBuilder, channel string) (*anycable.CommandResponse, error) {
+	return server.Command(context.Background(), &anycable.CommandMessage{
+		Command:               "subscribe",
+		Identifier:            `{"channel":"` + channel + `"}`,
+		ConnectionIdentifiers: `{}`,
+		Env:                   &anycable.Env{},
+	})
+}
+
+func streamingFrom(stream string) activego.SubscribedHandler {
+	return func(c activego.Connection, ch activego.Channel) error {
+		return ch.StreamFrom(stream)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("Admin::StatsChannel").Subscribed(streamingFrom("exact"))
+	server.Namespace("Admin").Channels("*").Subscribed(streamingFrom("namespace"))
+	server.ChannelsMatching(regexp.MustCompile(`^Room\d+Channel$`)).Subscribed(streamingFrom("regexp"))
+	server.FallbackChannel().Subscribed(streamingFrom("fallback"))
+
+	for channel, stream := range map[string]string{
+		"Admin::StatsChannel":        "exact",
+		"Admin::UsersChannel":        "namespace",
+		"Admin::Nested::LogsChannel": "namespace",
+		"Room42Channel":              "regexp",
+		"ChatChannel":                "fallback",
+	} {
+		r, err := subscribeTo(server, channel)
+		require.NoError(err)
+		require.Equal(anycable.Status_SUCCESS, r.Status, channel)
+		require.Equal([]string{stream}, r.Streams, channel)
+	}
+}
+
+func TestRouting_UnknownChannelRejected(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel")
+
+	r, err := subscribeTo(server, "OtherChannel")
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"type":"reject_subscription","identifier":"{\"channel\":\"OtherChannel\"}"}`}, r.Transmissions)
+}
+
+func TestRouting_InvalidIdentifierRejected(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel")
+
+	r, err := server.Command(context.Background(), &anycable.CommandMessage{
+		Command:               "subscribe",
+		Identifier:            `{"channel":`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"type":"reject_subscription","identifier":"{\"channel\":"}`}, r.Transmissions)
+}
+
+func TestRouting_PatternRateLimit(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channels("*Channel").
+		Received("speak", func(activego.Connection, activego.Channel, activego.ActionData) error { return nil }).
+		RateLimit("speak", activego.RateLimit{Rate: 1, Burst: 1})
+
+	perform := func(channel string) anycable.Status {
+		m := performMessage("speak")
+		m.Identifier = `{"channel":"` + channel + `"}`
+		r, err := server.Command(context.Background(), m)
+		require.NoError(err)
+		return r.Status
+	}
+	require.Equal(anycable.Status_SUCCESS, perform("ChatChannel"))
+	require.Equal(anycable.Status_FAILURE, perform("ChatChannel"))
+	// Buckets are kept per channel.
+	require.Equal(anycable.Status_SUCCESS, perform("RoomChannel"))
+}
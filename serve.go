@@ -0,0 +1,121 @@
+package activego
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bilus/activego/anycable"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+// ServeOptions configures the gRPC server used when running as an RPC
+// backend for a standalone anycable-go.
+type ServeOptions struct {
+	// Address to listen on, e.g. "0.0.0.0:50051" or ":50051".
+	Address string
+	// Listener, if set, is served instead of listening on Address.
+	Listener net.Listener
+	// TLSCertFile and TLSKeyFile enable TLS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// Keepalive and KeepaliveEnforcement are passed to gRPC as is; zero
+	// values mean gRPC defaults.
+	Keepalive            keepalive.ServerParameters
+	KeepaliveEnforcement keepalive.EnforcementPolicy
+	// MaxRecvMsgSize and MaxSendMsgSize are in bytes; zero means gRPC defaults.
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+	// Reflection registers the gRPC server reflection service.
+	Reflection bool
+	// DrainDelay is how long Shutdown keeps serving calls after health checks
+	// start reporting NOT_SERVING, giving load balancers time to stop
+	// routing new calls to the server.
+	DrainDelay time.Duration
+	// ServerOptions are appended to the options built from the fields above.
+	ServerOptions []grpc.ServerOption
+}
+
+type rpcServer struct {
+	mu         sync.Mutex
+	grpc       *grpc.Server
+	health     *health.Server
+	drainDelay time.Duration
+}
+
+// Serve listens on the port on all interfaces with default options.
+func (s *Server) Serve(port int) error {
+	return s.ServeWith(ServeOptions{Address: fmt.Sprintf(":%d", port)})
+}
+
+// ServeWith starts the RPC server along with the gRPC health checking service
+// and blocks until it stops.
+func (s *Server) ServeWith(opts ServeOptions) error {
+	serverOptions, err := opts.serverOptions()
+	if err != nil {
+		return err
+	}
+	lis := opts.Listener
+	if lis == nil {
+		lis, err = net.Listen("tcp", opts.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
+	anycable.RegisterRPCServer(grpcServer, s)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	if opts.Reflection {
+		reflection.Register(grpcServer)
+	}
+	s.rpc.mu.Lock()
+	s.rpc.grpc, s.rpc.health, s.rpc.drainDelay = grpcServer, healthServer, opts.DrainDelay
+	s.rpc.mu.Unlock()
+	return grpcServer.Serve(lis)
+}
+
+// Shutdown reports NOT_SERVING to health checks and, after the drain delay,
+// stops the RPC server once pending calls have finished.
+func (s *Server) Shutdown() {
+	s.rpc.mu.Lock()
+	grpcServer, healthServer, drainDelay := s.rpc.grpc, s.rpc.health, s.rpc.drainDelay
+	s.rpc.mu.Unlock()
+	if grpcServer == nil {
+		return
+	}
+	healthServer.Shutdown()
+	time.Sleep(drainDelay)
+	grpcServer.GracefulStop()
+}
+
+func (opts ServeOptions) serverOptions() ([]grpc.ServerOption, error) {
+	var result []grpc.ServerOption
+	if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+		result = append(result, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	}
+	if opts.Keepalive != (keepalive.ServerParameters{}) {
+		result = append(result, grpc.KeepaliveParams(opts.Keepalive))
+	}
+	if opts.KeepaliveEnforcement != (keepalive.EnforcementPolicy{}) {
+		result = append(result, grpc.KeepaliveEnforcementPolicy(opts.KeepaliveEnforcement))
+	}
+	if opts.MaxRecvMsgSize > 0 {
+		result = append(result, grpc.MaxRecvMsgSize(opts.MaxRecvMsgSize))
+	}
+	if opts.MaxSendMsgSize > 0 {
+		result = append(result, grpc.MaxSendMsgSize(opts.MaxSendMsgSize))
+	}
+	return append(result, opts.ServerOptions...), nil
+}
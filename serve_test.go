@@ -0,0 +1,59 @@
+package activego_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bilus/activego"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func serve(t *testing.T, opts activego.ServeOptions) (*activego.ServerBuilder, *grpc.ClientConn, <-chan error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	opts.Listener = lis
+	server := activego.BuildServer(nil)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeWith(opts)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	return server, conn, served
+}
+
+func TestServe_HealthCheck(t *testing.T) {
+	require := require.New(t)
+
+	server, conn, served := serve(t, activego.ServeOptions{})
+	defer conn.Close()
+
+	r, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(err)
+	require.Equal(healthpb.HealthCheckResponse_SERVING, r.Status)
+
+	server.Shutdown()
+	require.NoError(<-served)
+}
+
+func TestServe_DrainDelay(t *testing.T) {
+	require := require.New(t)
+
+	server, conn, served := serve(t, activego.ServeOptions{DrainDelay: 200 * time.Millisecond})
+	defer conn.Close()
+
+	go server.Shutdown()
+	health := healthpb.NewHealthClient(conn)
+	require.Eventually(func() bool {
+		r, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err == nil && r.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(<-served)
+}
@@ -5,37 +5,71 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 
 	"github.com/bilus/activego/anycable"
-	"github.com/davecgh/go-spew/spew"
-	grpc "google.golang.org/grpc"
 )
 
 type ActionData map[string]interface{}
 
+// ChannelIdentifier identifies a subscription. It's parsed once per command
+// and can't be modified; JSON returns it exactly as the client sent it,
+// which is how anycable tells subscriptions apart.
 type ChannelIdentifier struct {
-	Channel string `json:"channel"`
-	Params  map[string]interface{}
+	name string
+	// params are decoded when accessed; most commands never look at them.
+	params map[string]json.RawMessage
+	json   string
 }
 
-func (identifier *ChannelIdentifier) Unmarshal(bs []byte) error {
-	params := make(map[string]interface{})
-	if err := json.Unmarshal(bs, &params); err != nil {
-		return err
+// ParseChannelIdentifier parses the identifier of a subscription command.
+func ParseChannelIdentifier(js string) (ChannelIdentifier, error) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(js), &params); err != nil {
+		return ChannelIdentifier{}, err
 	}
-	i, ok := params["channel"]
-	if !ok {
-		return fmt.Errorf("missing %q in identifier", "channel")
+	var name string
+	if err := json.Unmarshal(params["channel"], &name); err != nil {
+		return ChannelIdentifier{}, fmt.Errorf("missing %q in identifier", "channel")
 	}
-	identifier.Channel, ok = i.(string)
+	delete(params, "channel")
+	return ChannelIdentifier{name: name, params: params, json: js}, nil
+}
+
+// Name is the channel name.
+func (identifier ChannelIdentifier) Name() string {
+	return identifier.name
+}
+
+// Param returns the value of an identifier key other than the channel name.
+func (identifier ChannelIdentifier) Param(k string) interface{} {
+	raw, ok := identifier.params[k]
 	if !ok {
-		return fmt.Errorf("missing %q in identifier", "channel")
+		return nil
 	}
-	identifier.Params = params
-	return nil
+	var v interface{}
+	json.Unmarshal(raw, &v) // nolint:errcheck
+	return v
+}
+
+// Params returns the identifier keys other than the channel name.
+func (identifier ChannelIdentifier) Params() map[string]interface{} {
+	params := make(map[string]interface{}, len(identifier.params))
+	for k := range identifier.params {
+		params[k] = identifier.Param(k)
+	}
+	return params
+}
+
+// JSON returns the identifier as sent by the client.
+func (identifier ChannelIdentifier) JSON() string {
+	return identifier.json
+}
+
+func (identifier ChannelIdentifier) String() string {
+	return identifier.json
 }
 
 type ConnectionIdentifiers map[string]interface{}
@@ -56,41 +90,65 @@ type Channel interface {
 	HandleSubscribe() error
 	HandleUnsubscribe() error
 	HandleAction(action string, data ActionData) error
-	IdentifierJSON() string
-	// TODO: Params() and Channel() string
 	Identifier() ChannelIdentifier
+	// Name is the channel name the client subscribed to.
+	Name() string
+	// Params returns a pointer to the struct declared with
+	// ChannelBuilder.Params or, if none was, the identifier params map.
+	Params() interface{}
 	StreamFrom(broadcasting string) error
 	StopStreamFrom(broadcasting string) error
 	Broadcast(stream string, data interface{}) error
+	// Transmit sends the message to the client as part of this subscription.
+	Transmit(message interface{}) error
 	State() State
 	Param(k string) interface{}
 	Reject() error
 }
 
-// TODO: Pass ChannelIdentifier.
 type ChannelFactory func(
 	connection Connection,
-	identifierJSON string,
+	identifier ChannelIdentifier,
 	socket *Socket,
 	broadcaster *Broadcaster) (Channel, error)
 
 type Connection interface {
 	HandleOpen() error
-	HandleCommand(identifier, command, data string) error
+	HandleCommand(identifier ChannelIdentifier, command, data string) error
 	HandleClose(subscriptions []string) error
 	Identifiers() ConnectionIdentifiers
 	IdentifiedBy(key string, value interface{}) error
 	State() State
 	URL() *url.URL
+	QueryParam(name string) string
 	Header() http.Header
+	Origin() string
+	UserAgent() string
+	// ForwardedHeaders returns the Forwarded and X-Forwarded-* headers.
+	ForwardedHeaders() http.Header
 	Cookie(name string) (*http.Cookie, error)
+	Cookies() []*http.Cookie
+	// SessionID is the id the node assigned to the client session.
+	SessionID() string
+	// ProtocolVersion is the RPC protocol version negotiated with the node.
+	ProtocolVersion() string
 	SaveToConnectionResponse(r *anycable.ConnectionResponse) error
 	SaveToCommandResponse(r *anycable.CommandResponse) error
-	Transmit(data interface{}) error
+	// Transmit sends one of the protocol transmissions to the client,
+	// rejecting ones that are malformed. Use Channel.Transmit for messages to
+	// a subscription.
+	Transmit(t Transmission) error
+	// TransmitRaw sends data to the client without any checks. It's a
+	// low-level escape hatch for frames outside the ActionCable protocol.
+	TransmitRaw(data interface{}) error
+	// Close transmits a disconnect message and closes the connection after the
+	// current command. Unsubscribed and Disconnected handlers still run.
+	Close(reason string, reconnect bool) error
 }
 
 type ConnectionFactory func(
 	c context.Context,
+	md RequestMetadata,
 	env *anycable.Env,
 	socket *Socket,
 	broadcaster *Broadcaster,
@@ -102,6 +160,20 @@ type Server struct {
 	ConnectionFactory ConnectionFactory
 	ChannelFactory    ChannelFactory
 	Broadcaster       *Broadcaster
+
+	// Configured with a ServerBuilder.
+	codec               Codec
+	stateCodec          Codec
+	whispers            map[string]*WhisperPolicy
+	connectionRateLimit *RateLimit
+	actionRateLimits    map[string]*RateLimit
+	// sealed is set once the server has been built.
+	sealed int32
+
+	rpc rpcServer
+	// routeKey maps a channel name to the key its rate limits and whisper
+	// policy are registered under, for channels routed by pattern.
+	routeKey func(channel string) string
 }
 
 // NewServer creates an instance of our server
@@ -110,44 +182,55 @@ func NewServer(connectionFactory ConnectionFactory, channelFactory ChannelFactor
 		ConnectionFactory: connectionFactory,
 		ChannelFactory:    channelFactory,
 		Broadcaster:       broadcaster,
+		codec:             DefaultCodec,
+		stateCodec:        DefaultCodec,
+		whispers:          make(map[string]*WhisperPolicy),
+		actionRateLimits:  make(map[string]*RateLimit),
 	}
 }
 
-func (s *Server) SetBroadcaster(broadcaster *Broadcaster) {
-	s.Broadcaster = broadcaster
+func (s *Server) channelKey(channel string) string {
+	if s.routeKey == nil {
+		return channel
+	}
+	return s.routeKey(channel)
 }
 
-func (s *Server) Serve(port int) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+// SetBroadcaster sets the broadcaster. It panics once the server has been
+// built with ServerBuilder.Build or Start.
+func (s *Server) SetBroadcaster(broadcaster *Broadcaster) {
+	if atomic.LoadInt32(&s.sealed) == 1 {
+		panic("activego: server configured after it was built")
 	}
-	grpcServer := grpc.NewServer()
-	anycable.RegisterRPCServer(grpcServer, s)
-	return grpcServer.Serve(lis)
+	s.Broadcaster = broadcaster
 }
 
 func (s *Server) Connect(c context.Context, r *anycable.ConnectionRequest) (*anycable.ConnectionResponse, error) {
-	fmt.Println("Connect")
-	spew.Dump(*r)
-	socket, err := NewSocket(r.Env, false)
+	md, err := requestMetadata(c)
+	if err != nil {
+		return nil, err
+	}
+	socket, err := acquireSocket(r.Env, false, s.codec, s.stateCodec)
 	if err != nil {
 		return nil, err
 	}
+	defer releaseSocket(socket)
 	// TODO: Just pass new channel, not factory?
-	connection, err := s.ConnectionFactory(c, r.Env, socket, s.Broadcaster, s.ChannelFactory, nil)
+	connection, err := s.ConnectionFactory(c, md, r.Env, socket, s.Broadcaster, s.ChannelFactory, nil)
 	if err != nil {
 		return nil, err
 	}
 	var response anycable.ConnectionResponse
-	if err := connection.HandleOpen(); err != nil {
-		socket.Write(DisconnectResponseTransmission{
-			Type:      "disconnect",
-			Reason:    err.Error(),
-			Reconnect: false,
-		})
+	if err := socket.checkState(connection.HandleOpen()); err != nil {
+		socket.Disconnect(err.Error(), false) // nolint:errcheck
 		response = anycable.ConnectionResponse{
-			Status: anycable.Status_FAILURE,
+			Status:   anycable.Status_FAILURE,
+			ErrorMsg: err.Error(),
+		}
+	} else if socket.disconnect {
+		response = anycable.ConnectionResponse{
+			Status:   anycable.Status_FAILURE,
+			ErrorMsg: "connection closed by the application",
 		}
 	} else {
 		identifiersJSON, err := connection.Identifiers().ToJSON()
@@ -157,39 +240,128 @@ func (s *Server) Connect(c context.Context, r *anycable.ConnectionRequest) (*any
 		response = anycable.ConnectionResponse{
 			Status:      anycable.Status_SUCCESS,
 			Identifiers: identifiersJSON,
-			// TODO: EnvResponse
 		}
 	}
 	if err := connection.SaveToConnectionResponse(&response); err != nil {
 		return nil, err
 	}
-	fmt.Println("Response")
-	spew.Dump(response)
 	return &response, nil
 }
 
 func (s *Server) Command(c context.Context, m *anycable.CommandMessage) (*anycable.CommandResponse, error) {
-	fmt.Println("Cmmand")
-	spew.Dump(*m)
-	socket, err := NewSocket(m.Env, false)
+	md, err := requestMetadata(c)
 	if err != nil {
 		return nil, err
 	}
-
+	socket, err := acquireSocket(m.Env, false, s.codec, s.stateCodec)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSocket(socket)
 	identifiers := ConnectionIdentifiers{}
 	if err := identifiers.FromJSON(m.ConnectionIdentifiers); err != nil {
 		return nil, err
 	}
-	connection, err := s.ConnectionFactory(c, m.Env, socket, s.Broadcaster, s.ChannelFactory, identifiers)
+	connection, err := s.ConnectionFactory(c, md, m.Env, socket, s.Broadcaster, s.ChannelFactory, identifiers)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.handleCommand(md, socket, connection, m)
 	if err != nil {
 		return nil, err
 	}
+	return response, nil
+}
+
+// CommandBatch handles several commands of one connection in a single call,
+// e.g. a page subscribing to many channels at once. The connection and its
+// state are decoded once; state changes made by a command are visible to the
+// ones following it. Once a command closes the connection, the following
+// ones fail. Responses are returned in the order of messages. If a command
+// fails with an error, the responses of the commands handled before it are
+// returned along with the error.
+func (s *Server) CommandBatch(c context.Context, messages []*anycable.CommandMessage) ([]*anycable.CommandResponse, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	md, err := requestMetadata(c)
+	if err != nil {
+		return nil, err
+	}
+	first := messages[0]
+	socket, err := acquireSocket(first.Env, false, s.codec, s.stateCodec)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSocket(socket)
+	identifiers := ConnectionIdentifiers{}
+	if err := identifiers.FromJSON(first.ConnectionIdentifiers); err != nil {
+		return nil, err
+	}
+	connection, err := s.ConnectionFactory(c, md, first.Env, socket, s.Broadcaster, s.ChannelFactory, identifiers)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range messages[1:] {
+		if m.ConnectionIdentifiers != first.ConnectionIdentifiers {
+			return nil, fmt.Errorf("batched commands must belong to one connection")
+		}
+	}
+	responses := make([]*anycable.CommandResponse, len(messages))
+	for i, m := range messages {
+		if i > 0 {
+			if err := socket.next(m.Env); err != nil {
+				return responses[:i], err
+			}
+		}
+		responses[i], err = s.handleCommand(md, socket, connection, m)
+		if err != nil {
+			return responses[:i], err
+		}
+		if responses[i].Disconnect {
+			// The connection is closing: the remaining commands fail
+			// without running any handlers.
+			for j := i + 1; j < len(messages); j++ {
+				responses[j] = &anycable.CommandResponse{
+					Status:   anycable.Status_FAILURE,
+					ErrorMsg: "connection closed",
+				}
+			}
+			break
+		}
+	}
+	return responses, nil
+}
+
+// handleCommand parses the identifier once for whispers, rate limits and
+// the connection.
+func (s *Server) handleCommand(md RequestMetadata, socket *Socket, connection Connection, m *anycable.CommandMessage) (*anycable.CommandResponse, error) {
+	identifier, err := ParseChannelIdentifier(m.Identifier)
+	if err != nil {
+		err = fmt.Errorf("error parsing channel identifier: %w", err)
+		if m.Command == "subscribe" {
+			err = rejectSubscription(socket, m.Identifier, err)
+		}
+		return s.commandResponse(socket, connection, m, err)
+	}
+	if m.Command == "message" {
+		if r, err := s.whisper(md.SessionID, m.ConnectionIdentifiers, identifier, m.Data); r != nil || err != nil {
+			return r, err
+		}
+	}
+	if limit := s.exceededRateLimit(md, m, identifier); limit != nil {
+		return s.rateLimited(socket, m, limit)
+	}
+	return s.commandResponse(socket, connection, m, connection.HandleCommand(identifier, m.Command, m.Data))
+}
+
+// commandResponse returns the response to a command handled with err.
+func (s *Server) commandResponse(socket *Socket, connection Connection, m *anycable.CommandMessage, err error) (*anycable.CommandResponse, error) {
 	var response anycable.CommandResponse
-	if err := connection.HandleCommand(m.Identifier, m.Command, m.Data); err != nil {
+	if err := socket.checkState(err); err != nil {
 		response = anycable.CommandResponse{
 			Status:   anycable.Status_FAILURE,
 			ErrorMsg: fmt.Sprintf("Error handling command %q: %v", m.Command, err),
-			// TODO
 		}
 	} else {
 		response = anycable.CommandResponse{
@@ -199,39 +371,41 @@ func (s *Server) Command(c context.Context, m *anycable.CommandMessage) (*anycab
 	if err := connection.SaveToCommandResponse(&response); err != nil {
 		return nil, err
 	}
-	fmt.Println("Response")
-	spew.Dump(response)
 	return &response, nil
 }
 
 func (s *Server) Disconnect(c context.Context, r *anycable.DisconnectRequest) (*anycable.DisconnectResponse, error) {
-	fmt.Println("Disconnect")
-	spew.Dump(*r)
-	socket, err := NewSocket(r.Env, true)
+	md, err := requestMetadata(c)
+	if err != nil {
+		return nil, err
+	}
+	s.forgetRateLimits(md, r.Identifiers)
+	socket, err := acquireSocket(r.Env, true, s.codec, s.stateCodec)
 	if err != nil {
 		return nil, err
 	}
+	defer releaseSocket(socket)
 	identifiers := ConnectionIdentifiers{}
 	if err := identifiers.FromJSON(r.Identifiers); err != nil {
 		return nil, err
 	}
-	connection, err := s.ConnectionFactory(c, r.Env, socket, s.Broadcaster, s.ChannelFactory, identifiers)
+	connection, err := s.ConnectionFactory(c, md, r.Env, socket, s.Broadcaster, s.ChannelFactory, identifiers)
 	if err != nil {
 		return nil, err
 	}
 	var response anycable.DisconnectResponse
-	if err := connection.HandleClose(r.Subscriptions); err != nil {
+	if err := socket.checkState(connection.HandleClose(r.Subscriptions)); err != nil {
 		response = anycable.DisconnectResponse{
 			Status:   anycable.Status_FAILURE,
 			ErrorMsg: fmt.Sprintf("Error handling disconnect: %v", err),
 		}
 	} else {
 		// TODO: Is DisconnectResponseTransmission the best name?
-		err = s.Broadcaster.Broadcast(r.Identifiers, DisconnectResponseTransmission{
+		err = s.Broadcaster.broadcast(r.Identifiers, DisconnectResponseTransmission{
 			Type:      "disconnect",
 			Reason:    "remote",
 			Reconnect: true,
-		})
+		}, nil, false)
 		if err != nil {
 			log.Printf("Error broadcasting disconnect command: %v", err)
 		}
@@ -239,7 +413,5 @@ func (s *Server) Disconnect(c context.Context, r *anycable.DisconnectRequest) (*
 			Status: anycable.Status_SUCCESS,
 		}
 	}
-	fmt.Println("Response")
-	spew.Dump(response)
 	return &response, nil
 }
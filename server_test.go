@@ -0,0 +1,345 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAdapter struct {
+	payloads []interface{}
+}
+
+func (a *recordingAdapter) BroadcastRaw(payload interface{}) error {
+	a.payloads = append(a.payloads, payload)
+	return nil
+}
+
+func TestServer_Close_FromAction(t *testing.T) {
+	require := require.New(t)
+
+	var unsubscribed, disconnected bool
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{}))
+	server.Disconnected(func(activego.Connection) error {
+		disconnected = true
+		return nil
+	})
+	server.Channel("ChatChannel").
+		Unsubscribed(func(activego.Connection, activego.Channel) error {
+			unsubscribed = true
+			return nil
+		}).
+		Received("kick", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			return c.Close("kicked", false)
+		})
+
+	r, err := server.Command(context.Background(), performMessage("kick"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.True(r.Disconnect)
+	require.Equal([]string{`{"type":"disconnect","reason":"kicked","reconnect":false}`}, r.Transmissions)
+
+	d, err := server.Disconnect(context.Background(), &anycable.DisconnectRequest{
+		Identifiers:   `{"user":"john"}`,
+		Subscriptions: []string{`{"channel":"ChatChannel"}`},
+		Env:           &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, d.Status)
+	require.True(unsubscribed)
+	require.True(disconnected)
+}
+
+func TestServer_Close_FromConnected(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		return c.Close("banned", false)
+	})
+
+	r, err := server.Connect(context.Background(), &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"type":"disconnect","reason":"banned","reconnect":false}`}, r.Transmissions)
+}
+
+func TestServer_Connect_Welcome(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		return c.TransmitRaw("hello")
+	})
+
+	r, err := server.Connect(context.Background(), &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal([]string{`{"type":"welcome"}`, `"hello"`}, r.Transmissions)
+}
+
+func TestServer_Metadata(t *testing.T) {
+	require := require.New(t)
+
+	var sessionID, version string
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		sessionID, version = c.SessionID(), c.ProtocolVersion()
+		return nil
+	})
+
+	c := anycable.NewIncomingContext(context.Background(), "abc123", "v0,v1")
+	r, err := server.Connect(c, &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Equal("abc123", sessionID)
+	require.Equal("v1", version)
+
+	c = anycable.NewIncomingContext(context.Background(), "abc123", "v0")
+	_, err = server.Connect(c, &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.Error(err)
+}
+
+func TestServer_Connect_ErrorMsg(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		return errors.New("unauthorized")
+	})
+
+	r, err := server.Connect(context.Background(), &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal("unauthorized", r.ErrorMsg)
+}
+
+func TestServer_BrokenState_FailsCommand(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			if ch.State().Get("room") == nil {
+				return ch.Transmit("no room")
+			}
+			return nil
+		})
+
+	m := performMessage("speak")
+	m.Env.Istate = map[string]string{"room": `{`}
+	r, err := server.Command(context.Background(), m)
+	require.NoError(err)
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Contains(r.ErrorMsg, `error decoding value for key room`)
+}
+
+func TestServer_SocketReleased(t *testing.T) {
+	require := require.New(t)
+
+	var kept activego.Channel
+	server := activego.BuildServer(nil)
+	server.Channel("ChatChannel").
+		Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			kept = ch
+			return nil
+		})
+
+	r, err := server.Command(context.Background(), performMessage("speak"))
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	err = kept.Transmit("late")
+	require.True(errors.Is(err, activego.ErrSocketReleased))
+	require.Empty(r.Transmissions)
+}
+
+func TestServer_Whisper_ExcludesSender(t *testing.T) {
+	require := require.New(t)
+
+	adapter := &recordingAdapter{}
+	server := activego.BuildServer(activego.NewBroadcaster(adapter))
+	server.Channel("ChatChannel").AllowWhisper("chat")
+
+	r, err := server.Command(anycable.NewIncomingContext(context.Background(), "sid1", "v1"), &anycable.CommandMessage{
+		Command:               "message",
+		Identifier:            `{"channel":"ChatChannel"}`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Data:                  `{"action":"whisper","typing":true}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal(anycable.Status_SUCCESS, r.Status)
+	require.Len(adapter.payloads, 1)
+	broadcast, ok := adapter.payloads[0].(*anycable.Broadcast)
+	require.True(ok)
+	require.Equal("chat", broadcast.Stream)
+	require.Equal("sid1", broadcast.Meta.ExcludeSocket)
+}
+
+func TestServer_Whisper_RejectionTransmitted(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{}))
+	server.Channel("ChatChannel").AllowWhisperWith(activego.WhisperPolicy{Stream: "chat", Rate: 1, Burst: 1})
+
+	whisper := func() *anycable.CommandResponse {
+		r, err := server.Command(anycable.NewIncomingContext(context.Background(), "sid1", "v1"), &anycable.CommandMessage{
+			Command:               "message",
+			Identifier:            `{"channel":"ChatChannel"}`,
+			ConnectionIdentifiers: `{}`,
+			Data:                  `{"action":"whisper"}`,
+			Env:                   &anycable.Env{},
+		})
+		require.NoError(err)
+		return r
+	}
+	require.Equal(anycable.Status_SUCCESS, whisper().Status)
+	r := whisper()
+	require.Equal(anycable.Status_FAILURE, r.Status)
+	require.Equal([]string{`{"message":{"type":"error","code":"rate_limited","message":"Rate limit exceeded"},"identifier":"{\"channel\":\"ChatChannel\"}"}`}, r.Transmissions)
+}
+
+func TestServer_SessionID(t *testing.T) {
+	require := require.New(t)
+
+	var sessionID string
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		sessionID = c.SessionID()
+		return nil
+	})
+
+	c := anycable.NewIncomingContext(context.Background(), "abc123", "v1")
+	_, err := server.Connect(c, &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+	require.Equal("abc123", sessionID)
+}
+
+func buildBenchmarkServer() *activego.ServerBuilder {
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		return c.IdentifiedBy("user", "john")
+	})
+	server.Channel("ChatChannel").
+		Subscribed(func(c activego.Connection, ch activego.Channel) error {
+			return ch.StreamFrom("chat")
+		}).
+		Received("speak", func(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
+			return nil
+		})
+	return server
+}
+
+// benchmarkEnv resembles what anycable sends: a few headers and some state
+// that most handlers never look at.
+func benchmarkEnv() *anycable.Env {
+	return &anycable.Env{
+		Url: "http://localhost:8080/cable?token=secret",
+		Headers: map[string]string{
+			"cookie":      "session=abc123",
+			"origin":      "http://localhost:8080",
+			"REMOTE_ADDR": "127.0.0.1",
+		},
+		Cstate: map[string]string{"user": `{"id":1,"name":"john"}`, "visits": "42"},
+		Istate: map[string]string{"room": `"lobby"`, "typing": "false"},
+	}
+}
+
+func BenchmarkServer_Connect(b *testing.B) {
+	server := buildBenchmarkServer()
+	request := &anycable.ConnectionRequest{Env: benchmarkEnv()}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := server.Connect(context.Background(), request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServer_Subscribe(b *testing.B) {
+	server := buildBenchmarkServer()
+	m := &anycable.CommandMessage{
+		Command:               "subscribe",
+		Identifier:            `{"channel":"ChatChannel","room":"lobby"}`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Env:                   benchmarkEnv(),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := server.Command(context.Background(), m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServer_Action(b *testing.B) {
+	server := buildBenchmarkServer()
+	m := &anycable.CommandMessage{
+		Command:               "message",
+		Identifier:            `{"channel":"ChatChannel","room":"lobby"}`,
+		ConnectionIdentifiers: `{"user":"john"}`,
+		Data:                  `{"action":"speak","message":"hello"}`,
+		Env:                   benchmarkEnv(),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := server.Command(context.Background(), m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestServer_RequestAccessors(t *testing.T) {
+	require := require.New(t)
+
+	var connection activego.Connection
+	server := activego.BuildServer(nil)
+	server.Connected(func(c activego.Connection) error {
+		connection = c
+		return nil
+	})
+
+	_, err := server.Connect(context.Background(), &anycable.ConnectionRequest{
+		Env: &anycable.Env{
+			Url: "http://example.com/cable?token=abc",
+			Headers: map[string]string{
+				"cookie":            "session=xyz; theme=dark",
+				"origin":            "http://example.com",
+				"user-agent":        "test",
+				"x-forwarded-for":   "1.2.3.4",
+				"x-forwarded-proto": "https",
+			},
+		},
+	})
+	require.NoError(err)
+	require.Equal("abc", connection.QueryParam("token"))
+	require.Equal("http://example.com", connection.Origin())
+	require.Equal("test", connection.UserAgent())
+	require.Equal("1.2.3.4", connection.Header().Get("X-Forwarded-For"))
+	forwarded := connection.ForwardedHeaders()
+	require.Len(forwarded, 2)
+	require.Equal("https", forwarded.Get("X-Forwarded-Proto"))
+	cookie, err := connection.Cookie("theme")
+	require.NoError(err)
+	require.Equal("dark", cookie.Value)
+	require.Len(connection.Cookies(), 2)
+}
+
+func TestParseChannelIdentifier(t *testing.T) {
+	require := require.New(t)
+
+	js := `{"channel":"RoomChannel","room":"lobby"}`
+	identifier, err := activego.ParseChannelIdentifier(js)
+	require.NoError(err)
+	require.Equal("RoomChannel", identifier.Name())
+	require.Equal("lobby", identifier.Param("room"))
+	require.Equal(map[string]interface{}{"room": "lobby"}, identifier.Params())
+	require.Equal(js, identifier.JSON())
+
+	_, err = activego.ParseChannelIdentifier(`{"room":"lobby"}`)
+	require.Error(err)
+}
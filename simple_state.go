@@ -1,45 +1,92 @@
 package activego
 
 import (
-	"encoding/json"
 	"fmt"
 )
 
+// simpleState decodes values lazily: anycable sends the whole state on every
+// call while handlers usually touch a key or two, if any.
 type simpleState struct {
+	raw           map[string]string
 	m             map[string]interface{}
 	changedFields map[string]struct{}
+	codec         Codec
+	// err is the first error decoding a value.
+	err error
 }
 
 func NewSimpleState(src map[string]interface{}) *simpleState {
 	return &simpleState{
-		m:             src,
-		changedFields: make(map[string]struct{}),
+		m:     src,
+		codec: DefaultCodec,
 	}
 }
 
 func DecodeSimpleState(src map[string]string) (*simpleState, error) {
-	state := NewSimpleState(make(map[string]interface{}))
-	for k, js := range src {
-		var v interface{}
-		if err := json.Unmarshal([]byte(js), &v); err != nil {
-			return nil, err
+	return DecodeSimpleStateWith(DefaultCodec, src)
+}
+
+// DecodeSimpleStateWith returns state whose values are encoded with the
+// codec. Values are decoded when first accessed.
+func DecodeSimpleStateWith(codec Codec, src map[string]string) (*simpleState, error) {
+	return &simpleState{
+		raw:   src,
+		codec: codec,
+	}, nil
+}
+
+// lookup returns the value at k, decoding it if it hasn't been accessed yet.
+func (state *simpleState) lookup(k string) (interface{}, bool, error) {
+	if v, ok := state.m[k]; ok {
+		return v, true, nil
+	}
+	encoded, ok := state.raw[k]
+	if !ok {
+		return nil, false, nil
+	}
+	var v interface{}
+	if err := state.codec.Unmarshal([]byte(encoded), &v); err != nil {
+		err = fmt.Errorf("error decoding value for key %v: %w", k, err)
+		if state.err == nil {
+			state.err = err
 		}
-		state.m[k] = v
+		return nil, false, err
 	}
-	return state, nil
+	if state.m == nil {
+		state.m = make(map[string]interface{})
+	}
+	state.m[k] = v
+	return v, true, nil
 }
 
-func (state simpleState) Get(k string) interface{} {
-	return state.m[k]
+// Get returns the value at k or nil if it's missing. A value that can't be
+// decoded is nil too and fails the command (see Err).
+func (state *simpleState) Get(k string) interface{} {
+	v, _, _ := state.lookup(k)
+	return v
+}
+
+// Err returns the first error decoding a value.
+func (state *simpleState) Err() error {
+	return state.err
 }
 
 func (state *simpleState) Set(k string, v interface{}) {
+	if state.changedFields == nil {
+		state.changedFields = make(map[string]struct{})
+	}
+	if state.m == nil {
+		state.m = make(map[string]interface{})
+	}
 	state.changedFields[k] = struct{}{}
 	state.m[k] = v
 }
 
 func (state *simpleState) UpdateString(k string, f func(string) string) error {
-	i, ok := state.m[k]
+	i, ok, err := state.lookup(k)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		return fmt.Errorf("missing value for key: %v", k)
 	}
@@ -52,7 +99,10 @@ func (state *simpleState) UpdateString(k string, f func(string) string) error {
 }
 
 func (state *simpleState) UpdateFloat64(k string, f func(float64) float64) error {
-	i, ok := state.m[k]
+	i, ok, err := state.lookup(k)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		return fmt.Errorf("missing value for key: %v", k)
 	}
@@ -66,11 +116,14 @@ func (state *simpleState) UpdateFloat64(k string, f func(float64) float64) error
 
 // TODO: UpdateMap, UpdateBool, Update
 
-func (state simpleState) Changes() (map[string]string, error) {
-	result := make(map[string]string)
+func (state *simpleState) Changes() (map[string]string, error) {
+	if len(state.changedFields) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(state.changedFields))
 	for k := range state.changedFields {
 		v := state.m[k]
-		bs, err := json.Marshal(v)
+		bs, err := state.codec.Marshal(v)
 		if err != nil {
 			return nil, err
 		}
@@ -79,8 +132,8 @@ func (state simpleState) Changes() (map[string]string, error) {
 	return result, nil
 }
 
-func (state simpleState) RawChanges() (map[string]interface{}, error) {
-	result := make(map[string]interface{})
+func (state *simpleState) RawChanges() (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(state.changedFields))
 	for k := range state.changedFields {
 		result[k] = state.m[k]
 	}
@@ -1,7 +1,8 @@
 package activego
 
 import (
-	"encoding/json"
+	"errors"
+	"sync"
 
 	"github.com/bilus/activego/anycable"
 )
@@ -13,48 +14,183 @@ type State interface {
 	UpdateFloat64(k string, f func(float64) float64) error
 	Changes() (map[string]string, error)
 	Select(k string)
+	// Err returns the first error decoding a value, if any. The server fails
+	// the command with it.
+	Err() error
 }
 
+// ErrSocketReleased is returned when writing to a socket after the call it
+// was created for has returned.
+var ErrSocketReleased = errors.New("socket used after the call returned")
+
 type Socket struct {
+	welcome        bool
+	unsubscribeAll bool
+	disconnect     bool
+	// acknowledged is set once an ack or error carrying a command ID has been
+	// transmitted, e.g. by TransmitError.
+	acknowledged bool
+	// output is nil once the socket has been released.
+	output     *socketOutput
+	cstate     State
+	istate     State
+	identifier *string
+	codec      Codec
+	stateCodec Codec
+}
+
+// socketOutput holds what a command sends back to the node. It's pooled
+// rather than the socket itself, which handlers may keep around.
+type socketOutput struct {
 	transmissions      []string
-	unsubscribeAll     bool
 	newSubscriptions   []string
 	newUnsubscriptions []string
-	cstate             State
-	istate             State
-	identifier         *string
 }
 
-func NewSocket(env *anycable.Env, disconnect bool) (*Socket, error) {
-	var err error
-	cstate, err := DecodeSimpleState(env.Cstate)
-	if err != nil {
+// reset truncates the slices so their storage can be reused; responses get
+// copies.
+func (o *socketOutput) reset() {
+	o.transmissions = o.transmissions[:0]
+	o.newSubscriptions = o.newSubscriptions[:0]
+	o.newUnsubscriptions = o.newUnsubscriptions[:0]
+}
+
+// NewSocket returns a socket encoding transmissions with codec and state with
+// stateCodec.
+func NewSocket(env *anycable.Env, disconnect bool, codec, stateCodec Codec) (*Socket, error) {
+	socket := &Socket{output: &socketOutput{}}
+	if err := socket.init(env, disconnect, codec, stateCodec); err != nil {
 		return nil, err
 	}
+	return socket, nil
+}
+
+var socketOutputPool = sync.Pool{
+	New: func() interface{} { return &socketOutput{} },
+}
+
+// acquireSocket is NewSocket reusing the output buffers of previous calls.
+// The socket must be released once its output has been saved to the
+// response; writing to it afterwards fails with ErrSocketReleased.
+func acquireSocket(env *anycable.Env, disconnect bool, codec, stateCodec Codec) (*Socket, error) {
+	socket := &Socket{output: socketOutputPool.Get().(*socketOutput)}
+	if err := socket.init(env, disconnect, codec, stateCodec); err != nil {
+		releaseSocket(socket)
+		return nil, err
+	}
+	return socket, nil
+}
+
+func releaseSocket(socket *Socket) {
+	output := socket.output
+	socket.output = nil
+	output.reset()
+	socketOutputPool.Put(output)
+}
+
+func (s *Socket) init(env *anycable.Env, disconnect bool, codec, stateCodec Codec) error {
+	cstate, err := DecodeSimpleStateWith(stateCodec, env.Cstate)
+	if err != nil {
+		return err
+	}
 	var istate State
 	if disconnect {
-		istate, err = DecodeNestedState(env.Istate)
+		istate, err = DecodeNestedStateWith(stateCodec, env.Istate)
 	} else {
-		istate, err = DecodeSimpleState(env.Istate)
+		istate, err = DecodeSimpleStateWith(stateCodec, env.Istate)
 	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+	s.cstate = cstate
+	s.istate = istate
+	s.codec = codec
+	s.stateCodec = stateCodec
+	return nil
+}
+
+// reset clears the output of a command.
+func (s *Socket) reset() {
+	s.welcome = false
+	s.unsubscribeAll = false
+	s.disconnect = false
+	s.acknowledged = false
+	s.output.reset()
+	s.identifier = nil
+}
+
+// next prepares the socket for another command of the same connection: the
+// connection state is kept while channel state and command output are reset.
+func (s *Socket) next(env *anycable.Env) error {
+	istate, err := DecodeSimpleStateWith(s.stateCodec, env.Istate)
+	if err != nil {
+		return err
+	}
+	s.istate = istate
+	s.reset()
+	return nil
+}
+
+// checkState returns err or, failing that, the first error decoding
+// connection or channel state while handling the call, so state that can't be
+// decoded fails the call rather than being treated as missing.
+func (s *Socket) checkState(err error) error {
+	if err != nil {
+		return err
+	}
+	if err := s.cstate.Err(); err != nil {
+		return err
+	}
+	return s.istate.Err()
+}
+
+// Transmit validates the transmission before writing it.
+func (s *Socket) Transmit(t Transmission) error {
+	if err := t.Validate(); err != nil {
+		return err
 	}
-	return &Socket{
-		cstate: cstate,
-		istate: istate,
-	}, nil
+	if err := s.Write(t); err != nil {
+		return err
+	}
+	if m, ok := t.(MessageResponseTransmission); ok {
+		var commandID interface{}
+		switch message := m.Message.(type) {
+		case AckMessage:
+			commandID = message.CommandID
+		case ErrorMessage:
+			commandID = message.CommandID
+		}
+		if commandID != nil {
+			s.acknowledged = true
+		}
+	}
+	return nil
 }
 
+// Write encodes and sends data to the client as is. Prefer Transmit.
 func (s *Socket) Write(t interface{}) error {
-	json, err := json.Marshal(t)
+	if s.output == nil {
+		return ErrSocketReleased
+	}
+	bs, err := s.codec.Marshal(t)
 	if err != nil {
 		return err
 	}
-	s.transmissions = append(s.transmissions, string(json))
+	s.output.transmissions = append(s.output.transmissions, string(bs))
 	return nil
 }
 
+// Disconnect transmits a disconnect message and asks the node to close the
+// connection once the command has been handled.
+func (s *Socket) Disconnect(reason string, reconnect bool) error {
+	s.disconnect = true
+	return s.Transmit(DisconnectResponseTransmission{
+		Type:      "disconnect",
+		Reason:    reason,
+		Reconnect: reconnect,
+	})
+}
+
 func (s *Socket) GetCState() State {
 	return s.cstate
 }
@@ -63,12 +199,18 @@ func (s *Socket) GetIState() State {
 	return s.istate
 }
 
+// Subscribe streams from the broadcasting once the command has been
+// handled. It does nothing once the socket has been released.
 func (s *Socket) Subscribe(broadcasting string) {
-	s.newSubscriptions = append(s.newSubscriptions, broadcasting)
+	if s.output != nil {
+		s.output.newSubscriptions = append(s.output.newSubscriptions, broadcasting)
+	}
 }
 
 func (s *Socket) Unsubscribe(broadcasting string) {
-	s.newUnsubscriptions = append(s.newUnsubscriptions, broadcasting)
+	if s.output != nil {
+		s.output.newUnsubscriptions = append(s.output.newUnsubscriptions, broadcasting)
+	}
 }
 
 func (s *Socket) UnsubscribeAll() {
@@ -76,35 +218,44 @@ func (s *Socket) UnsubscribeAll() {
 }
 
 func (s *Socket) SaveToCommandResponse(r *anycable.CommandResponse) error {
-	r.Transmissions = append(r.Transmissions, s.transmissions...)
-	r.Streams = append(r.Streams, s.newSubscriptions...)
-	r.StoppedStreams = append(r.StoppedStreams, s.newUnsubscriptions...)
+	r.Transmissions = append(r.Transmissions, s.output.transmissions...)
+	r.Streams = append(r.Streams, s.output.newSubscriptions...)
+	r.StoppedStreams = append(r.StoppedStreams, s.output.newUnsubscriptions...)
 	r.StopStreams = r.StopStreams || s.unsubscribeAll
+	r.Disconnect = r.Disconnect || s.disconnect
 	var err error
 	r.Env, err = s.envResponse()
 	return err
 }
 
+// Welcome accepts the connection. The welcome message is transmitted before
+// any other unless the connection is closed while it's being opened.
+func (s *Socket) Welcome() {
+	s.welcome = true
+}
+
 func (s *Socket) SaveToConnectionResponse(r *anycable.ConnectionResponse) error {
-	r.Transmissions = append(r.Transmissions, s.transmissions...)
+	if s.welcome && !s.disconnect {
+		bs, err := s.codec.Marshal(WelcomeResponseTransmission{Type: "welcome"})
+		if err != nil {
+			return err
+		}
+		r.Transmissions = append(r.Transmissions, string(bs))
+	}
+	r.Transmissions = append(r.Transmissions, s.output.transmissions...)
 	var err error
 	r.Env, err = s.envResponse()
 	return err
 }
 
 func (s *Socket) envResponse() (*anycable.EnvResponse, error) {
-	response := anycable.EnvResponse{
-		Cstate: make(map[string]string),
-		Istate: make(map[string]string),
-	}
-	var err error
-	response.Cstate, err = s.cstate.Changes()
+	cstate, err := s.cstate.Changes()
 	if err != nil {
 		return nil, err
 	}
-	response.Istate, err = s.istate.Changes()
+	istate, err := s.istate.Changes()
 	if err != nil {
 		return nil, err
 	}
-	return &response, nil
+	return &anycable.EnvResponse{Cstate: cstate, Istate: istate}, nil
 }
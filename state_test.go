@@ -3,13 +3,14 @@ package activego_test
 import (
 	"testing"
 
+	"github.com/bilus/activego"
 	"github.com/stretchr/testify/require"
 )
 
 func TestState_SimpleState_FromNil(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(nil)
+	state, err := activego.DecodeSimpleState(nil)
 	require.NoError(err)
 	require.Nil(state.Get("foo"))
 }
@@ -17,7 +18,7 @@ func TestState_SimpleState_FromNil(t *testing.T) {
 func TestState_SimpleState_FromMap(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`})
 	require.NoError(err)
 	require.Equal("bar", state.Get("foo"))
 }
@@ -25,7 +26,7 @@ func TestState_SimpleState_FromMap(t *testing.T) {
 func TestState_SimpleState_Set(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`})
 	require.NoError(err)
 	state.Set("foo", "qux")
 	require.Equal("qux", state.Get("foo"))
@@ -34,7 +35,7 @@ func TestState_SimpleState_Set(t *testing.T) {
 func TestState_SimpleState_Update_CorrectType(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`})
 	require.NoError(err)
 	err = state.UpdateString("foo", func(v string) string { return v + "BAR" })
 	require.NoError(err)
@@ -44,7 +45,7 @@ func TestState_SimpleState_Update_CorrectType(t *testing.T) {
 func TestState_SimpleState_Update_IncorrectType(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`})
 	require.NoError(err)
 	err = state.UpdateFloat64("foo", func(v float64) float64 { return v + 1 })
 	require.Error(err)
@@ -54,7 +55,7 @@ func TestState_SimpleState_Update_IncorrectType(t *testing.T) {
 func TestState_SimpleState_Changes_NoChanges(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`})
 	require.NoError(err)
 	changes, err := state.Changes()
 	require.NoError(err)
@@ -64,7 +65,7 @@ func TestState_SimpleState_Changes_NoChanges(t *testing.T) {
 func TestState_SimpleState_Changes_Set(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`, "baz": `"qux"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`, "baz": `"qux"`})
 	require.NoError(err)
 	state.Set("baz", "XXX")
 	changes, err := state.Changes()
@@ -75,7 +76,7 @@ func TestState_SimpleState_Changes_Set(t *testing.T) {
 func TestState_SimpleState_Changes_Update(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeSimpleState(map[string]string{"foo": `"bar"`, "baz": `"qux"`})
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`, "baz": `"qux"`})
 	require.NoError(err)
 	err = state.UpdateString("baz", func(string) string { return "XXX" })
 	require.NoError(err)
@@ -87,7 +88,7 @@ func TestState_SimpleState_Changes_Update(t *testing.T) {
 func TestState_NestedState_SelectIState(t *testing.T) {
 	require := require.New(t)
 
-	state, err := anycable.DecodeNestedState(map[string]string{"foo": `{"bar": "baz"}`})
+	state, err := activego.DecodeNestedState(map[string]string{"foo": `{"bar": "\"baz\""}`})
 	require.NoError(err)
 	state.Select("foo")
 	err = state.UpdateString("bar", func(string) string { return "XXX" })
@@ -95,5 +96,27 @@ func TestState_NestedState_SelectIState(t *testing.T) {
 	require.Equal("XXX", state.Get("bar"))
 	changes, err := state.Changes()
 	require.NoError(err)
-	require.Equal(map[string]string{"foo": `{"bar": "XXX"}`}, changes)
+	require.Equal(map[string]string{"foo": `{"bar":"XXX"}`}, changes)
+}
+
+func TestState_SimpleState_DecodesLazily(t *testing.T) {
+	require := require.New(t)
+
+	state, err := activego.DecodeSimpleState(map[string]string{"foo": `"bar"`, "broken": `{`})
+	require.NoError(err)
+	require.Equal("bar", state.Get("foo"))
+	require.NoError(state.Err())
+	require.Nil(state.Get("broken"))
+	require.Error(state.Err())
+	require.Error(state.UpdateString("broken", func(v string) string { return v }))
+}
+
+func TestState_NestedState_BrokenChannelState(t *testing.T) {
+	require := require.New(t)
+
+	state, err := activego.DecodeNestedState(map[string]string{"chat": `{`})
+	require.NoError(err)
+	state.Select("chat")
+	require.Nil(state.Get("foo"))
+	require.Error(state.Err())
 }
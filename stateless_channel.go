@@ -1,24 +1,18 @@
 package activego
 
 type statelessChannel struct {
-	socket         *Socket
-	broadcaster    *Broadcaster
-	identifierJSON string // TODO: Marshal identifier instead of keeping two fields.
-	identifier     ChannelIdentifier
+	socket      *Socket
+	broadcaster *Broadcaster
+	identifier  ChannelIdentifier
+	params      interface{}
 }
 
-// TODO: Pass ChannelIdentifier instead of JSON.
-func NewStatelessChannel(identifierJSON string, socket *Socket, broadcaster *Broadcaster) (*statelessChannel, error) {
-	identifier := ChannelIdentifier{}
-	if err := identifier.Unmarshal([]byte(identifierJSON)); err != nil {
-		return nil, err
-	}
+func NewStatelessChannel(identifier ChannelIdentifier, socket *Socket, broadcaster *Broadcaster) *statelessChannel {
 	return &statelessChannel{
-		identifierJSON: identifierJSON,
-		identifier:     identifier,
-		socket:         socket,
-		broadcaster:    broadcaster,
-	}, nil
+		identifier:  identifier,
+		socket:      socket,
+		broadcaster: broadcaster,
+	}
 }
 
 func (ch *statelessChannel) HandleSubscribe() error {
@@ -33,10 +27,6 @@ func (ch *statelessChannel) HandleAction(action string, data ActionData) error {
 	return nil
 }
 
-func (ch *statelessChannel) IdentifierJSON() string {
-	return ch.identifierJSON
-}
-
 func (ch *statelessChannel) Identifier() ChannelIdentifier {
 	return ch.identifier
 }
@@ -55,17 +45,35 @@ func (ch *statelessChannel) Broadcast(stream string, data interface{}) error {
 	return ch.broadcaster.Broadcast(stream, data)
 }
 
+func (ch *statelessChannel) Transmit(message interface{}) error {
+	return ch.socket.Transmit(MessageResponseTransmission{
+		Message:    message,
+		Identifier: ch.identifier.JSON(),
+	})
+}
+
 func (ch *statelessChannel) State() State {
 	return ch.socket.GetIState()
 }
 
 func (ch *statelessChannel) Reject() error {
-	return ch.socket.Write(CommandResponseTransmission{
+	return ch.socket.Transmit(CommandResponseTransmission{
 		Type:       "reject_subscription",
-		Identifier: ch.IdentifierJSON(),
+		Identifier: ch.identifier.JSON(),
 	})
 }
 
+func (ch *statelessChannel) Name() string {
+	return ch.identifier.Name()
+}
+
+func (ch *statelessChannel) Params() interface{} {
+	if ch.params != nil {
+		return ch.params
+	}
+	return ch.identifier.Params()
+}
+
 func (ch *statelessChannel) Param(k string) interface{} {
-	return ch.identifier.Params[k]
+	return ch.identifier.Param(k)
 }
@@ -1,63 +1,66 @@
 package activego
 
 import (
-	context "context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	reflect "reflect"
+	"strings"
 
 	"github.com/apex/log"
 	"github.com/bilus/activego/anycable"
-	"github.com/iancoleman/strcase"
 )
 
 type StatelessConnection struct {
 	env         *anycable.Env
-	request     *http.Request
 	identifiers ConnectionIdentifiers
 
+	// Parsed from env on first access; most commands never look at them.
+	url     *url.URL
+	query   url.Values
+	header  http.Header
+	cookies []*http.Cookie
+
+	sessionID       string
+	protocolVersion string
+
 	socket      *Socket
 	broadcaster *Broadcaster
 
 	channelFactory ChannelFactory
 }
 
-func NewStatelessConnection(c context.Context, env *anycable.Env, socket *Socket, broadcaster *Broadcaster, channelFactory ChannelFactory, identifiers ConnectionIdentifiers) (*StatelessConnection, error) {
-	header := http.Header{}
-	for key, value := range env.Headers {
-		header.Set(key, value)
-	}
-	u, err := url.Parse(env.Url)
-	if err != nil {
-		return nil, err
-	}
+func NewStatelessConnection(md RequestMetadata, env *anycable.Env, socket *Socket, broadcaster *Broadcaster, channelFactory ChannelFactory, identifiers ConnectionIdentifiers) (*StatelessConnection, error) {
 	if identifiers == nil {
 		identifiers = make(ConnectionIdentifiers)
 	}
-	request := http.Request{Header: header, URL: u}
 	return &StatelessConnection{
-		env:            env,
-		request:        &request,
-		socket:         socket,
-		broadcaster:    broadcaster,
-		channelFactory: channelFactory,
-		identifiers:    identifiers,
+		env:             env,
+		socket:          socket,
+		broadcaster:     broadcaster,
+		channelFactory:  channelFactory,
+		identifiers:     identifiers,
+		sessionID:       md.SessionID,
+		protocolVersion: md.ProtocolVersion,
 	}, nil
 }
 
 // TODO: Handle authorization failure.
 func (c *StatelessConnection) HandleOpen() error {
-	return c.socket.Write(WelcomeResponseTransmission{
-		Type: "welcome",
-	})
+	c.socket.Welcome()
+	return nil
 }
 
 func (c *StatelessConnection) HandleClose(subscriptions []string) error {
-	for _, identifier := range subscriptions {
+	for _, identifierJSON := range subscriptions {
 		// TODO: Pass istate properly.
-		c.socket.GetIState().Select(identifier)
+		c.socket.GetIState().Select(identifierJSON)
+		identifier, err := ParseChannelIdentifier(identifierJSON)
+		if err != nil {
+			log.Errorf("Error parsing channel identifier %q: %v", identifierJSON, err)
+			continue
+		}
 		channel, err := c.channelFactory(c, identifier, c.socket, c.broadcaster)
 		if err != nil {
 			log.Errorf("Error creating channel %q: %v", identifier, err)
@@ -70,68 +73,99 @@ func (c *StatelessConnection) HandleClose(subscriptions []string) error {
 	return nil
 }
 
-func (c *StatelessConnection) HandleCommand(identifier, command, data string) error {
+func (c *StatelessConnection) HandleCommand(identifier ChannelIdentifier, command, data string) error {
+	identifierJSON := identifier.JSON()
 	channel, err := c.channelFactory(c, identifier, c.socket, c.broadcaster)
+	if command == "subscribe" && errors.Is(err, ErrUnknownChannel) {
+		return rejectSubscription(c.socket, identifierJSON, err)
+	}
 	if err != nil {
-		return fmt.Errorf("error creating channel: %v", err)
+		return fmt.Errorf("error creating channel: %w", err)
 	}
 
 	switch command {
 	case "subscribe":
+		if checker, ok := channel.(paramsChecker); ok {
+			if err := checker.checkParams(); err != nil {
+				return rejectSubscription(c.socket, identifierJSON, err)
+			}
+		}
 		// TODO: Handle reject (ok, err)
 		if err := channel.HandleSubscribe(); err != nil {
+			// The subscription failed even if the error was handled, so the
+			// client is told it's been rejected.
+			if rescued, _ := rescue(channel, err); rescued {
+				return rejectSubscription(c.socket, identifierJSON, err)
+			}
 			return err
 		}
-		return c.socket.Write(CommandResponseTransmission{
+		return c.socket.Transmit(CommandResponseTransmission{
 			Type:       "confirm_subscription",
-			Identifier: identifier,
+			Identifier: identifierJSON,
 		})
 	case "unsubscribe":
-		return channel.HandleUnsubscribe()
+		_, err := rescue(channel, channel.HandleUnsubscribe())
+		return err
 	case "message":
 		parsedData := ActionData{}
 		if err = json.Unmarshal([]byte(data), &parsedData); err != nil {
 			return fmt.Errorf("error parsing data %v: %v", data, err)
 		}
-		actionI, ok := parsedData["action"]
-		if ok {
-			action, ok := actionI.(string)
-			if !ok {
-				return fmt.Errorf("expecting action to be a string, got: %q", actionI)
-			}
-			if err = handleAction(channel, action, parsedData); err != nil {
-				return fmt.Errorf("error handling action %q: %v", action, err)
+		_, err = rescue(channel, handleMessage(channel, parsedData))
+		// Error handlers may have reported the error already, e.g. with
+		// TransmitError, or closed the connection.
+		if commandID, ok := parsedData[CommandIDKey]; ok && !c.socket.acknowledged && !c.socket.disconnect {
+			if ackErr := c.acknowledge(identifierJSON, commandID, err); ackErr != nil {
+				return ackErr
 			}
 		}
-		return nil
+		return err
 	default:
 		return fmt.Errorf("unsupported command %q", command)
 	}
 }
 
-func handleAction(channel Channel, action string, data ActionData) error {
-	// ok, err := callChannelMethod(channel, action, data)
-	// if err != nil {
-	// 	return err
-	// }
-	// if !ok {
-	return channel.HandleAction(action, data)
-	// }
-	// return nil
+// rejectSubscription tells the client its subscription was rejected and
+// returns err, which fails the command.
+func rejectSubscription(socket *Socket, identifierJSON string, err error) error {
+	if transmitErr := socket.Transmit(CommandResponseTransmission{
+		Type:       "reject_subscription",
+		Identifier: identifierJSON,
+	}); transmitErr != nil {
+		return transmitErr
+	}
+	return err
 }
 
-func callChannelMethod(channel Channel, action string, data ActionData) (bool, error) {
-	methodName := strcase.ToCamel(action)
-	method := reflect.ValueOf(channel).MethodByName(methodName)
-	if !method.IsValid() {
-		return false, nil
+func handleMessage(channel Channel, data ActionData) error {
+	actionI, ok := data["action"]
+	if !ok {
+		receiver, ok := channel.(dataReceiver)
+		if !ok {
+			return nil
+		}
+		return receiver.receive(data)
+	}
+	action, ok := actionI.(string)
+	if !ok {
+		return fmt.Errorf("expecting action to be a string, got: %q", actionI)
+	}
+	if err := handleAction(channel, action, data); err != nil {
+		return &ActionError{Action: action, CommandID: data[CommandIDKey], Err: err}
 	}
-	result := method.Call([]reflect.Value{reflect.ValueOf(data)})
-	err := result[0].Interface()
-	if err == nil {
-		return true, nil
+	return nil
+}
+
+// rescue passes errors to the channel's error handlers, if any.
+func rescue(channel Channel, err error) (bool, error) {
+	if rescuer, ok := channel.(errorRescuer); ok && err != nil {
+		return rescuer.rescue(err)
 	}
-	return true, err.(error)
+	return false, err
+}
+
+func handleAction(channel Channel, action string, data ActionData) error {
+	return channel.HandleAction(action, data)
 }
 
 func (c *StatelessConnection) Identifiers() ConnectionIdentifiers {
@@ -155,18 +189,109 @@ func (c *StatelessConnection) State() State {
 	return c.socket.GetCState()
 }
 
+func (c *StatelessConnection) SessionID() string {
+	return c.sessionID
+}
+
+func (c *StatelessConnection) ProtocolVersion() string {
+	return c.protocolVersion
+}
+
+// URL returns the URL the client connected to. A malformed URL is logged and
+// reported as an empty one.
 func (c *StatelessConnection) URL() *url.URL {
-	return c.request.URL
+	if c.url == nil {
+		u, err := url.Parse(c.env.Url)
+		if err != nil {
+			log.Errorf("Error parsing connection URL %q: %v", c.env.Url, err)
+			u = &url.URL{}
+		}
+		c.url = u
+	}
+	return c.url
+}
+
+// QueryParam returns the first value of the URL's query param.
+func (c *StatelessConnection) QueryParam(name string) string {
+	if c.query == nil {
+		c.query = c.URL().Query()
+	}
+	return c.query.Get(name)
 }
 
+// Header returns the headers passed by the node. Keys are canonicalized, so
+// use Get rather than indexing with the lowercase names anycable sends. Only
+// the headers the node is configured to pass are present.
 func (c *StatelessConnection) Header() http.Header {
-	return c.request.Header
+	if c.header == nil {
+		c.header = make(http.Header, len(c.env.Headers))
+		for key, value := range c.env.Headers {
+			c.header.Set(key, value)
+		}
+	}
+	return c.header
+}
+
+// headerValue looks a header up without building Header.
+func (c *StatelessConnection) headerValue(name string) string {
+	if value, ok := c.env.Headers[strings.ToLower(name)]; ok {
+		return value
+	}
+	for key, value := range c.env.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (c *StatelessConnection) Origin() string {
+	return c.headerValue("Origin")
+}
+
+func (c *StatelessConnection) UserAgent() string {
+	return c.headerValue("User-Agent")
+}
+
+// ForwardedHeaders returns the Forwarded and X-Forwarded-* headers set by
+// proxies in front of the node. Clients can forge them, so only trust them
+// if such a proxy overwrites them.
+func (c *StatelessConnection) ForwardedHeaders() http.Header {
+	forwarded := http.Header{}
+	for key, value := range c.env.Headers {
+		lower := strings.ToLower(key)
+		if lower == "forwarded" || strings.HasPrefix(lower, "x-forwarded-") {
+			forwarded.Set(key, value)
+		}
+	}
+	return forwarded
 }
 
 func (c *StatelessConnection) Cookie(name string) (*http.Cookie, error) {
-	return c.request.Cookie(name)
+	for _, cookie := range c.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, http.ErrNoCookie
 }
 
-func (c *StatelessConnection) Transmit(data interface{}) error {
+func (c *StatelessConnection) Cookies() []*http.Cookie {
+	if c.cookies == nil {
+		request := http.Request{Header: http.Header{"Cookie": {c.headerValue("Cookie")}}}
+		c.cookies = request.Cookies()
+	}
+	return c.cookies
+}
+
+func (c *StatelessConnection) Transmit(t Transmission) error {
+	return c.socket.Transmit(t)
+}
+
+func (c *StatelessConnection) TransmitRaw(data interface{}) error {
 	return c.socket.Write(data)
 }
+
+func (c *StatelessConnection) Close(reason string, reconnect bool) error {
+	return c.socket.Disconnect(reason, reconnect)
+}
@@ -10,36 +10,18 @@ import (
 
 func Setup(server *activego.ServerBuilder) {
 	server.Connected(Connected)
-	channels := []string{
-		"Anyt::TestChannels::SubscriptionAknowledgementRejectorChannel",
-		"Anyt::TestChannels::SubscriptionTransmissionsChannel",
-		"Anyt::TestChannels::SubscriptionPerformMethodsChannel",
-		"Anyt::TestChannels::SubscriptionWithParamsChannel",
-		"Anyt::TestChannels::SubscriptionAknowledgementChannel",
-		"Anyt::TestChannels::RequestChannel",
-		"Anyt::TestChannels::RequestAChannel",
-		"Anyt::TestChannels::RequestBChannel",
-		"Anyt::TestChannels::RequestCChannel",
-		"Anyt::TestChannels::SingleStreamChannel",
-		"Anyt::TestChannels::BroadcastDataToStreamChannel",
-		"Anyt::TestChannels::StreamsWithManyClientsChannel",
-		"Anyt::TestChannels::StopStreamsChannel",
-		"Anyt::TestChannels::MultipleStreamsChannel",
-		"Anyt::TestChannels::ChannelStateChannel",
-	}
-	for _, name := range channels {
-		ch := server.Channel(name)
-		ch.Subscribed(Subscribed).Unsubscribed(Unsubscribed)
-		ch.Received("tick", Tick)
-		ch.Received("unfollow", Unfollow)
-		ch.Received("echo", Echo)
-	}
+	server.Namespace("Anyt").Namespace("TestChannels").Channels("*").
+		Subscribed(Subscribed).
+		Unsubscribed(Unsubscribed).
+		Received("tick", Tick).
+		Received("unfollow", Unfollow).
+		Received("echo", Echo)
 }
 
 type TestCases map[string]func() bool
 
 func (testCases TestCases) runAll(c activego.Connection) error {
-	testName := c.URL().Query().Get("test")
+	testName := c.QueryParam("test")
 	if testName == "" {
 		testName = "*" // Special catch all for default behaviour.
 	}
@@ -76,10 +58,10 @@ func Connected(c activego.Connection) error {
 			return c.Header().Get("X-Api-Token") == "abc"
 		},
 		"reasons": func() bool {
-			return c.URL().Query().Get("reason") != "unauthorized"
+			return c.QueryParam("reason") != "unauthorized"
 		},
 		"uid": func() bool {
-			uid := c.URL().Query().Get("uid")
+			uid := c.QueryParam("uid")
 			err := c.IdentifiedBy("uid", uid)
 			if err != nil {
 				log.Printf("Error calling IdentifiedBy: %v", err)
@@ -97,18 +79,12 @@ func Connected(c activego.Connection) error {
 }
 
 func Subscribed(c activego.Connection, ch activego.Channel) error {
-	switch ch.Identifier().Channel {
+	switch ch.Name() {
 	case "Anyt::TestChannels::SubscriptionAknowledgementRejectorChannel":
 		return ch.Reject()
 	case "Anyt::TestChannels::SubscriptionTransmissionsChannel":
-		c.Transmit(activego.MessageResponseTransmission{
-			Message:    "hello",
-			Identifier: ch.IdentifierJSON(), // TODO: Pass Identifier itself.
-		})
-		c.Transmit(activego.MessageResponseTransmission{
-			Message:    "world",
-			Identifier: ch.IdentifierJSON(),
-		})
+		ch.Transmit("hello")
+		ch.Transmit("world")
 	case "Anyt::TestChannels::RequestAChannel":
 		ch.StreamFrom("request_a")
 	case "Anyt::TestChannels::RequestBChannel":
@@ -132,19 +108,19 @@ func Subscribed(c activego.Connection, ch activego.Channel) error {
 		// TODO: Wrap it in a DSL.
 		state := ch.State()
 		state.Set("count", 1)
-		state.Set("user", map[string]interface{}{"name": ch.Identifier().Params["name"]})
+		state.Set("user", map[string]interface{}{"name": ch.Param("name")})
 	}
 	return nil
 }
 
 func Unsubscribed(c activego.Connection, ch activego.Channel) error {
-	switch ch.Identifier().Channel {
+	switch ch.Name() {
 	case "Anyt::TestChannels::RequestAChannel":
 		ch.Broadcast("request_a", map[string]string{"data": "user left"})
 	case "Anyt::TestChannels::RequestBChannel":
 		ch.Broadcast("request_b", map[string]string{"data": "user left"})
 	case "Anyt::TestChannels::RequestCChannel":
-		ch.Broadcast("request_c", map[string]string{"data": fmt.Sprintf("user left%v", ch.Identifier().Params["id"])})
+		ch.Broadcast("request_c", map[string]string{"data": fmt.Sprintf("user left%v", ch.Param("id"))})
 	case "Anyt::TestChannels::ChannelStateChannel":
 		if ch.Param("notify_disconnect") == nil {
 			return nil
@@ -160,20 +136,14 @@ func Unsubscribed(c activego.Connection, ch activego.Channel) error {
 }
 
 func Tick(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
-	switch ch.Identifier().Channel {
+	switch ch.Name() {
 	case "Anyt::TestChannels::ChannelStateChannel":
 		state := ch.State()
 		state.UpdateFloat64("count", func(v float64) float64 { return v + 2 })
 		user := state.Get("user").(map[string]interface{})
-		return c.Transmit(activego.MessageResponseTransmission{
-			Message:    map[string]interface{}{"count": state.Get("count"), "name": user["name"]},
-			Identifier: ch.IdentifierJSON(),
-		})
+		return ch.Transmit(map[string]interface{}{"count": state.Get("count"), "name": user["name"]})
 	default:
-		return c.Transmit(activego.MessageResponseTransmission{
-			Message:    "tock",
-			Identifier: ch.IdentifierJSON(),
-		})
+		return ch.Transmit("tock")
 	}
 }
 
@@ -182,10 +152,7 @@ func Unfollow(c activego.Connection, ch activego.Channel, data activego.ActionDa
 }
 
 func Echo(c activego.Connection, ch activego.Channel, data activego.ActionData) error {
-	return c.Transmit(activego.MessageResponseTransmission{
-		Message: map[string]interface{}{
-			"response": data["text"],
-		},
-		Identifier: ch.IdentifierJSON(),
+	return ch.Transmit(map[string]interface{}{
+		"response": data["text"],
 	})
 }
@@ -0,0 +1,251 @@
+package activego
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Subscriber is implemented by channel types handling subscriptions.
+type Subscriber interface {
+	Subscribed(Connection) error
+}
+
+// Unsubscriber is implemented by channel types handling unsubscriptions.
+type Unsubscriber interface {
+	Unsubscribed(Connection) error
+}
+
+// Performer is implemented by channel types handling actions, like
+// ChannelBuilder.ReceivedAny. Actions registered with ChannelBuilder.Received
+// take precedence.
+type Performer interface {
+	Perform(c Connection, action string, data ActionData) error
+}
+
+// Connector is implemented by connection types handling new connections.
+type Connector interface {
+	Connect() error
+}
+
+// Disconnector is implemented by connection types handling closed
+// connections.
+type Disconnector interface {
+	Disconnect() error
+}
+
+var (
+	channelType    = reflect.TypeOf((*Channel)(nil)).Elem()
+	connectionType = reflect.TypeOf((*Connection)(nil)).Elem()
+)
+
+// container holds the dependencies provided with ServerBuilder.Provide.
+type container struct {
+	values []reflect.Value
+}
+
+// resolve finds the dependency for a field: one of exactly its type or,
+// failing that, the first one assignable to it.
+func (c *container) resolve(typ reflect.Type) (reflect.Value, bool) {
+	for _, value := range c.values {
+		if value.Type() == typ {
+			return value, true
+		}
+	}
+	for _, value := range c.values {
+		if value.Type().AssignableTo(typ) {
+			return value, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// structType instantiates a channel or connection type. Embedded or
+// exported fields of type Channel and Connection are set to the ones handling
+// the command and exported fields tagged `inject:""` get dependencies from the
+// container.
+type structType struct {
+	typ        reflect.Type
+	channel    []int
+	connection []int
+	injected   [][]int
+	container  *container
+}
+
+func newStructType(prototype interface{}, container *container) (*structType, error) {
+	typ := reflect.TypeOf(prototype)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type must be a struct, got %T", prototype)
+	}
+	t := &structType{typ: typ, container: container}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		switch {
+		case (field.Type == channelType || field.Type == connectionType) && field.PkgPath != "":
+			return nil, fmt.Errorf("%s.%s: %s fields must be embedded or exported", typ, field.Name, field.Type)
+		case field.Type == channelType:
+			t.channel = field.Index
+		case field.Type == connectionType:
+			t.connection = field.Index
+		case hasTag(field, "inject"):
+			if field.PkgPath != "" {
+				return nil, fmt.Errorf("%s.%s: injected fields must be exported", typ, field.Name)
+			}
+			t.injected = append(t.injected, field.Index)
+		}
+	}
+	return t, nil
+}
+
+func hasTag(field reflect.StructField, key string) bool {
+	_, ok := field.Tag.Lookup(key)
+	return ok
+}
+
+// unresolved lists injected fields the container has no dependency for.
+func (t *structType) unresolved() []error {
+	var problems []error
+	for _, index := range t.injected {
+		field := t.typ.FieldByIndex(index)
+		if _, ok := t.container.resolve(field.Type); !ok {
+			problems = append(problems, fmt.Errorf("%s.%s: no %s provided", t.typ, field.Name, field.Type))
+		}
+	}
+	return problems
+}
+
+// implements reports whether pointers to the type implement any of the
+// interfaces.
+func (t *structType) implements(interfaces ...interface{}) bool {
+	ptr := reflect.PtrTo(t.typ)
+	for _, i := range interfaces {
+		if ptr.Implements(reflect.TypeOf(i).Elem()) {
+			return true
+		}
+	}
+	return false
+}
+
+// instantiate returns a pointer to a new struct.
+func (t *structType) instantiate(connection Connection, channel Channel) interface{} {
+	ptr := reflect.New(t.typ)
+	v := ptr.Elem()
+	if t.channel != nil && channel != nil {
+		v.FieldByIndex(t.channel).Set(reflect.ValueOf(channel))
+	}
+	if t.connection != nil && connection != nil {
+		v.FieldByIndex(t.connection).Set(reflect.ValueOf(connection))
+	}
+	for _, index := range t.injected {
+		if dep, ok := t.container.resolve(v.FieldByIndex(index).Type()); ok {
+			v.FieldByIndex(index).Set(dep)
+		}
+	}
+	return ptr.Interface()
+}
+
+// Provide adds dependencies injected into fields tagged `inject:""` of
+// channel and connection types. A field gets the dependency of exactly its
+// type or, failing that, the first one assignable to it, so interfaces can be
+// injected too.
+func (b *ServerBuilder) Provide(dependencies ...interface{}) *ServerBuilder {
+	b.register(func() {
+		for _, dependency := range dependencies {
+			if dependency == nil {
+				b.problems = append(b.problems, errors.New("nil dependency provided"))
+				continue
+			}
+			b.container.values = append(b.container.values, reflect.ValueOf(dependency))
+		}
+	})
+	return b
+}
+
+// ChannelType registers a struct type handling the channel, as an
+// alternative to handler functions. A new instance is created for every
+// command, with the Channel it embeds set and dependencies injected (see
+// Provide). Pointers to the type must implement at least one of Subscriber,
+// Unsubscriber, Performer and Receiver:
+//
+//	type ChatChannel struct {
+//		activego.Channel
+//		Messages *MessageStore `inject:""`
+//	}
+//
+//	func (ch *ChatChannel) Subscribed(c activego.Connection) error {
+//		return ch.StreamFrom("chat_" + ch.Param("room").(string))
+//	}
+func (b *ServerBuilder) ChannelType(name string, prototype interface{}) *ChannelBuilder {
+	channel := b.Channel(name)
+	channel.Type(prototype)
+	return channel
+}
+
+// Type makes a struct type handle the channel; see ServerBuilder.ChannelType.
+func (b *ChannelBuilder) Type(prototype interface{}) *ChannelBuilder {
+	b.builder.register(func() {
+		t, err := newStructType(prototype, b.builder.container)
+		if err == nil && !t.implements((*Subscriber)(nil), (*Unsubscriber)(nil), (*Performer)(nil), (*Receiver)(nil)) {
+			err = fmt.Errorf("%s implements none of Subscriber, Unsubscriber, Performer and Receiver", t.typ)
+		}
+		if err != nil {
+			b.builder.problems = append(b.builder.problems, fmt.Errorf("channel %q: %v", b.name, err))
+			return
+		}
+		b.handlers.typ = t
+		if t.implements((*Subscriber)(nil)) {
+			b.handlers.subscribed = func(c Connection, ch Channel) error {
+				return t.instantiate(c, ch).(Subscriber).Subscribed(c)
+			}
+		}
+		if t.implements((*Unsubscriber)(nil)) {
+			b.handlers.unsubscribed = func(c Connection, ch Channel) error {
+				return t.instantiate(c, ch).(Unsubscriber).Unsubscribed(c)
+			}
+		}
+		if t.implements((*Performer)(nil)) {
+			b.handlers.perform = func(c Connection, ch Channel, action string, data ActionData) error {
+				return t.instantiate(c, ch).(Performer).Perform(c, action, data)
+			}
+		}
+		if t.implements((*Receiver)(nil)) {
+			b.handlers.actionHandlers[ReceiveAction] = func(c Connection, ch Channel, data ActionData) error {
+				return t.instantiate(c, ch).(Receiver).Receive(c, data)
+			}
+		}
+	})
+	return b
+}
+
+// ConnectionType registers a struct type handling connections, as an
+// alternative to Connected and Disconnected. A new instance is created for
+// every call, with the Connection it embeds set and dependencies injected
+// (see Provide). Pointers to the type must implement Connector, Disconnector
+// or both.
+func (b *ServerBuilder) ConnectionType(prototype interface{}) *ServerBuilder {
+	b.register(func() {
+		t, err := newStructType(prototype, b.container)
+		if err == nil && !t.implements((*Connector)(nil), (*Disconnector)(nil)) {
+			err = fmt.Errorf("%s implements neither Connector nor Disconnector", t.typ)
+		}
+		if err != nil {
+			b.problems = append(b.problems, fmt.Errorf("connection type: %v", err))
+			return
+		}
+		b.connectionType = t
+		if t.implements((*Connector)(nil)) {
+			b.handlers.connected = func(c Connection) error {
+				return t.instantiate(c, nil).(Connector).Connect()
+			}
+		}
+		if t.implements((*Disconnector)(nil)) {
+			b.handlers.disconnected = func(c Connection) error {
+				return t.instantiate(c, nil).(Disconnector).Disconnect()
+			}
+		}
+	})
+	return b
+}
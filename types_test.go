@@ -0,0 +1,106 @@
+package activego_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bilus/activego"
+	"github.com/bilus/activego/anycable"
+	"github.com/stretchr/testify/require"
+)
+
+type messageStore struct {
+	messages []string
+}
+
+type storeChannel struct {
+	activego.Channel
+	Store *messageStore `inject:""`
+
+	performed int
+}
+
+func (ch *storeChannel) Subscribed(c activego.Connection) error {
+	return ch.StreamFrom("store_" + ch.Param("room").(string))
+}
+
+func (ch *storeChannel) Perform(c activego.Connection, action string, data activego.ActionData) error {
+	ch.performed++
+	ch.Store.messages = append(ch.Store.messages, action)
+	return ch.Transmit(map[string]interface{}{"performed": ch.performed})
+}
+
+type userConnection struct {
+	activego.Connection
+	Store *messageStore `inject:""`
+}
+
+func (c *userConnection) Connect() error {
+	c.Store.messages = append(c.Store.messages, "connect")
+	return nil
+}
+
+func TestServerBuilder_ChannelType(t *testing.T) {
+	require := require.New(t)
+
+	store := &messageStore{}
+	server := activego.BuildServer(nil)
+	server.Provide(store).ConnectionType(userConnection{})
+	server.ChannelType("StoreChannel", storeChannel{})
+
+	_, err := server.Connect(context.Background(), &anycable.ConnectionRequest{Env: &anycable.Env{}})
+	require.NoError(err)
+
+	identifier := `{"channel":"StoreChannel","room":"lobby"}`
+	r, err := server.Command(context.Background(), &anycable.CommandMessage{
+		Command:               "subscribe",
+		Identifier:            identifier,
+		ConnectionIdentifiers: `{}`,
+		Env:                   &anycable.Env{},
+	})
+	require.NoError(err)
+	require.Equal([]string{"store_lobby"}, r.Streams)
+
+	for i := 0; i < 2; i++ {
+		r, err = server.Command(context.Background(), &anycable.CommandMessage{
+			Command:               "message",
+			Identifier:            identifier,
+			ConnectionIdentifiers: `{}`,
+			Data:                  `{"action":"speak"}`,
+			Env:                   &anycable.Env{},
+		})
+		require.NoError(err)
+		require.Equal(anycable.Status_SUCCESS, r.Status)
+		// Every command gets a new instance.
+		require.Equal([]string{`{"message":{"performed":1},"identifier":"{\"channel\":\"StoreChannel\",\"room\":\"lobby\"}"}`}, r.Transmissions)
+	}
+	require.Equal([]string{"connect", "speak", "speak"}, store.messages)
+}
+
+type hiddenChannel struct {
+	ch activego.Channel
+}
+
+func (h *hiddenChannel) Subscribed(c activego.Connection) error {
+	return h.ch.StreamFrom("hidden")
+}
+
+func TestServerBuilder_ChannelType_Invalid(t *testing.T) {
+	require := require.New(t)
+
+	server := activego.BuildServer(activego.NewBroadcaster(&recordingAdapter{}))
+	server.ChannelType("StoreChannel", storeChannel{})
+	server.ChannelType("EmptyChannel", struct{}{})
+	server.ChannelType("FuncChannel", func() {})
+	server.ChannelType("HiddenChannel", hiddenChannel{})
+
+	_, err := server.Build()
+	var configErr *activego.ConfigError
+	require.True(errors.As(err, &configErr))
+	require.Len(configErr.Problems, 4)
+	require.Contains(err.Error(), "no *activego_test.messageStore provided")
+	require.Contains(err.Error(), "implements none of")
+	require.Contains(err.Error(), "must be a struct")
+	require.Contains(err.Error(), "hiddenChannel.ch: activego.Channel fields must be embedded or exported")
+}
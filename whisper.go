@@ -0,0 +1,110 @@
+package activego
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bilus/activego/anycable"
+	"github.com/bilus/activego/ratelimit"
+)
+
+// WhisperAction is the action name clients use to whisper, e.g.
+// `subscription.perform("whisper", {typing: true})`.
+const WhisperAction = "whisper"
+
+const (
+	DefaultWhisperMaxSize = 4096
+	DefaultWhisperRate    = 10.0
+	DefaultWhisperBurst   = 20
+)
+
+// WhisperPolicy controls how ephemeral client-to-client messages sent to a
+// channel are relayed to other subscribers.
+type WhisperPolicy struct {
+	// Stream the whispers are broadcast to.
+	Stream string
+	// MaxSize is the maximum size of the message data in bytes.
+	MaxSize int
+	// Rate and Burst limit whispers per connection and subscription.
+	Rate  float64
+	Burst int
+
+	limiter *ratelimit.Limiter
+}
+
+func newWhisperPolicy(policy WhisperPolicy) *WhisperPolicy {
+	if policy.MaxSize == 0 {
+		policy.MaxSize = DefaultWhisperMaxSize
+	}
+	if policy.Rate == 0 {
+		policy.Rate = DefaultWhisperRate
+	}
+	if policy.Burst == 0 {
+		policy.Burst = DefaultWhisperBurst
+	}
+	policy.limiter = ratelimit.NewLimiter(policy.Rate, policy.Burst)
+	return &policy
+}
+
+// whisper relays a whisper to the channel's whisper stream, skipping the
+// sender's socket, without running any handlers. It returns a nil response if
+// data isn't a whisper or the channel doesn't allow whispering so the message
+// can be handled as a regular action. Whispers over the size or rate limits
+// fail, and an ErrorMessage tells the client why.
+//
+// The relayed message also carries the sender's identifiers in `from`.
+func (s *Server) whisper(sid, identifiers string, identifier ChannelIdentifier, data string) (*anycable.CommandResponse, error) {
+	if len(s.whispers) == 0 {
+		return nil, nil
+	}
+	parsedData := ActionData{}
+	if err := json.Unmarshal([]byte(data), &parsedData); err != nil {
+		return nil, nil
+	}
+	if parsedData["action"] != WhisperAction {
+		return nil, nil
+	}
+	policy, ok := s.whispers[s.channelKey(identifier.Name())]
+	if !ok {
+		return nil, nil
+	}
+	if len(data) > policy.MaxSize {
+		return s.whisperRejected(identifier.JSON(), "too_large", fmt.Sprintf("Whisper exceeds %d bytes", policy.MaxSize))
+	}
+	if !policy.limiter.Allow(sid + identifier.JSON()) {
+		return s.whisperRejected(identifier.JSON(), "rate_limited", "Rate limit exceeded")
+	}
+	from := ConnectionIdentifiers{}
+	if err := from.FromJSON(identifiers); err != nil {
+		return nil, err
+	}
+	delete(parsedData, "action")
+	err := s.Broadcaster.broadcast(policy.Stream, WhisperTransmission{
+		Type:    "whisper",
+		From:    from,
+		Message: parsedData,
+	}, &anycable.BroadcastMeta{ExcludeSocket: sid}, false)
+	if err != nil {
+		return nil, err
+	}
+	return &anycable.CommandResponse{Status: anycable.Status_SUCCESS}, nil
+}
+
+func (s *Server) whisperRejected(identifierJSON, code, message string) (*anycable.CommandResponse, error) {
+	transmission, err := s.codec.Marshal(MessageResponseTransmission{
+		Message: ErrorMessage{
+			Type:    "error",
+			Code:    code,
+			Message: message,
+		},
+		Identifier: identifierJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &anycable.CommandResponse{
+		Status:        anycable.Status_FAILURE,
+		ErrorMsg:      fmt.Sprintf("Whisper rejected: %s", message),
+		Transmissions: []string{string(transmission)},
+	}, nil
+}